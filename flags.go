@@ -0,0 +1,99 @@
+package kommando
+
+import (
+	"github.com/yigit433/kommando/types"
+)
+
+// FlagOption customizes a flag built by one of the flag constructors.
+type FlagOption func(flag *types.Flag)
+
+func newFlag(name, description, valueType string, opts []FlagOption) types.Flag {
+	flag := types.Flag{
+		Required:    &[]bool{false}[0],
+		Name:        name,
+		Description: description,
+		ValueType:   valueType,
+	}
+
+	for _, opt := range opts {
+		opt(&flag)
+	}
+
+	return flag
+}
+
+// FlagsFromStruct declares the flags described by the kommando tags of the
+// struct v points to. It panics on an invalid tag or field type; see
+// types.FlagsFromStruct for the error-returning version.
+func FlagsFromStruct(v interface{}) []types.Flag {
+	flags, err := types.FlagsFromStruct(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return flags
+}
+
+// StringFlag declares an optional flag that takes any value.
+func StringFlag(name, description string, opts ...FlagOption) types.Flag {
+	return newFlag(name, description, "string", opts)
+}
+
+// BoolFlag declares an optional flag that is true when given.
+func BoolFlag(name, description string, opts ...FlagOption) types.Flag {
+	return newFlag(name, description, "bool", opts)
+}
+
+// IntFlag declares an optional flag that takes an integer.
+func IntFlag(name, description string, opts ...FlagOption) types.Flag {
+	return newFlag(name, description, "int", opts)
+}
+
+// FloatFlag declares an optional flag that takes a number.
+func FloatFlag(name, description string, opts ...FlagOption) types.Flag {
+	return newFlag(name, description, "float", opts)
+}
+
+// WithRequired marks the flag as required.
+func WithRequired() FlagOption {
+	return func(flag *types.Flag) {
+		flag.Required = &[]bool{true}[0]
+	}
+}
+
+// WithPattern sets the regular expression values must match, and the
+// description shown instead of it in error messages.
+func WithPattern(pattern, description string) FlagOption {
+	return func(flag *types.Flag) {
+		flag.Pattern = pattern
+		flag.PatternDescription = description
+	}
+}
+
+// WithNormalize sets the function that rewrites values before validation.
+func WithNormalize(normalize func(string) string) FlagOption {
+	return func(flag *types.Flag) {
+		flag.Normalize = normalize
+	}
+}
+
+// WithAllowed restricts the flag to the given values.
+func WithAllowed(values ...string) FlagOption {
+	return func(flag *types.Flag) {
+		flag.Allowed = values
+	}
+}
+
+// WithAllowedIgnoreCase makes the allowed values match regardless of case.
+func WithAllowedIgnoreCase() FlagOption {
+	return func(flag *types.Flag) {
+		flag.AllowedIgnoreCase = true
+	}
+}
+
+// WithHidden hides the flag from help and the commands listing.
+func WithHidden() FlagOption {
+	return func(flag *types.Flag) {
+		flag.Hidden = true
+	}
+}
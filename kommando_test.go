@@ -1,9 +1,22 @@
 package kommando
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/yigit433/kommando/kommandotest"
 	"github.com/yigit433/kommando/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestKommandoApp(t *testing.T) {
@@ -23,3 +36,2779 @@ func TestKommandoApp(t *testing.T) {
 
 	app.Run()
 }
+
+func TestKommandoOutput(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Output App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "test",
+			Description: "This is a test command!",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	var first, second bytes.Buffer
+
+	app.SetArgs([]string{})
+	app.SetOutput(&first)
+	app.Run()
+
+	if !strings.Contains(first.String(), "Kommando Output App") {
+		t.Fatalf("expected command list in output, got %q", first.String())
+	}
+
+	app.SetOutput(&second)
+	app.Run()
+
+	if first.String() != second.String() {
+		t.Fatalf("expected identical output across runs, got %q and %q", first.String(), second.String())
+	}
+
+	if strings.Count(second.String(), "help |>") != 1 {
+		t.Fatalf("expected help to be listed once, got %q", second.String())
+	}
+}
+
+func TestKommandoSetArgs(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Args App",
+	}
+
+	var received []string
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "echo",
+			Description: "Echoes its arguments.",
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args["args"].([]string)
+			},
+		},
+	)
+
+	var out bytes.Buffer
+
+	app.SetOutput(&out)
+	app.SetArgs([]string{"echo", "hello", "world"})
+	app.Run()
+
+	if strings.Join(received, " ") != "hello world" {
+		t.Fatalf("expected args to reach the command, got %v", received)
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("expected no list output, got %q", out.String())
+	}
+
+	app.SetArgs([]string{})
+	app.Run()
+
+	if !strings.Contains(out.String(), "echo |> Echoes its arguments.") {
+		t.Fatalf("expected command list for empty args, got %q", out.String())
+	}
+}
+
+func TestKommandoCloneCommand(t *testing.T) {
+	base := &types.Command{
+		Name:        "get",
+		Description: "Gets a resource.",
+		Flags: []types.Flag{
+			{Required: &[]bool{false}[0], Name: "output", Description: "Output format.", ValueType: "string"},
+		},
+		FlagSets: []string{"kube"},
+		Aliases:  []string{"g"},
+		Execute:  func(res *types.CmdResponse) {},
+	}
+
+	clone := base.Clone(func(cmd *types.Command) {
+		cmd.Name = "describe"
+		cmd.Aliases[0] = "d"
+		cmd.FlagSets[0] = "aws"
+	})
+
+	clone.Flags[0].Name = "format"
+	*clone.Flags[0].Required = true
+	clone.Flags = append(clone.Flags, types.Flag{Required: &[]bool{false}[0], Name: "extra", ValueType: "string"})
+
+	if clone.Name != "describe" || base.Name != "get" {
+		t.Fatalf("expected override to rename only the clone, got %q and %q", clone.Name, base.Name)
+	}
+
+	if base.Aliases[0] != "g" || base.FlagSets[0] != "kube" {
+		t.Fatalf("expected original aliases and flag sets untouched, got %v and %v", base.Aliases, base.FlagSets)
+	}
+
+	if len(base.Flags) != 1 || base.Flags[0].Name != "output" || *base.Flags[0].Required {
+		t.Fatalf("expected original flags untouched, got %+v", base.Flags)
+	}
+}
+
+func TestKommandoFlagSets(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando FlagSet App",
+	}
+
+	kube := types.NewFlagSet("kube",
+		types.Flag{Required: &[]bool{false}[0], Name: "namespace", Description: "Namespace.", ValueType: "string"},
+		types.Flag{Required: &[]bool{false}[0], Name: "context", Description: "Context.", ValueType: "string"},
+	)
+
+	app.AddFlagSet(kube)
+
+	var namespace interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "get",
+			Description: "Gets a resource.",
+			FlagSets:    []string{"kube"},
+			Execute: func(res *types.CmdResponse) {
+				namespace = res.Args["namespace"]
+			},
+		},
+	)
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "delete",
+			Description: "Deletes a resource.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "force", Description: "Force.", ValueType: "bool"},
+			},
+			FlagSets: []string{"kube"},
+			Execute:  func(res *types.CmdResponse) {},
+		},
+	)
+
+	var out bytes.Buffer
+
+	app.SetOutput(&out)
+	app.SetArgs([]string{"get", "--namespace=prod"})
+	app.Run()
+
+	if namespace != "prod" {
+		t.Fatalf("expected namespace flag from the set to parse, got %v", namespace)
+	}
+
+	app.SetArgs([]string{"help", "delete"})
+	app.Run()
+
+	if !strings.Contains(out.String(), "Flags |> --force, --namespace, --context") {
+		t.Fatalf("expected expanded flags in help, got %q", out.String())
+	}
+
+	kube.Flags = append(kube.Flags, types.Flag{Name: "output", Description: "Output.", ValueType: "string"})
+
+	res, err := app.ParseE([]string{"delete", "--output", "yaml"})
+	if err != nil || res.Args["output"] != "yaml" {
+		t.Fatalf("expected a flag added to the set later to parse, got %v and %v", res, err)
+	}
+
+	out.Reset()
+	app.SetArgs([]string{"help", "get"})
+	app.Run()
+
+	if !strings.Contains(out.String(), "Flags |> --namespace, --context, --output") {
+		t.Fatalf("expected a flag added to the set later in help, got %q", out.String())
+	}
+
+	kube.Flags = append(kube.Flags, types.Flag{Name: "force", ValueType: "bool"})
+
+	if _, err := app.ParseE([]string{"delete"}); !errors.Is(err, types.ErrDuplicateFlag) {
+		t.Fatalf("expected a set clashing with the command's flags to fail, got %v", err)
+	}
+}
+
+func TestKommandoSortFlags(t *testing.T) {
+	app := types.Config{
+		AppName:   "Kommando Sorted App",
+		SortFlags: true,
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "zone", ValueType: "string"},
+				{Required: &[]bool{false}[0], Name: "app", ValueType: "string"},
+				{Required: &[]bool{false}[0], Name: "force", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	var out bytes.Buffer
+
+	app.SetOutput(&out)
+	app.SetArgs([]string{"help", "deploy"})
+	app.Run()
+
+	if !strings.Contains(out.String(), "Flags |> --app, --force, --zone") {
+		t.Fatalf("expected sorted flags in help, got %q", out.String())
+	}
+}
+
+func TestKommandotestRunCommand(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Helper App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{Required: &[]bool{true}[0], Name: "zone", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				fmt.Fprintln(app.ErrorOutput(), "deploying to", res.Args["zone"])
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app)
+
+	if res.Err != nil || res.Panic != nil || !strings.Contains(res.Stdout, "deploy |> Deploys the app.") {
+		t.Fatalf("expected command list, got %+v", res)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "deploy", "positional")
+
+	kommandotest.RequireError(t, res, types.ErrRequiredFlag)
+
+	if app.Output() != os.Stdout || app.ErrorOutput() != os.Stderr {
+		t.Fatalf("expected the output writers to be restored")
+	}
+
+	res = kommandotest.RunCommand(t, &app, "deploy", "--zone", "eu")
+
+	if res.Err != nil || res.Stderr != "deploying to eu\n" || res.Stdout != "" {
+		t.Fatalf("expected error output to be captured separately, got %+v", res)
+	}
+
+	var out, errOut bytes.Buffer
+
+	app.SetOutput(&out)
+	app.SetErrorOutput(&errOut)
+	app.SetArgs([]string{"deploy", "--zone", "us"})
+
+	kommandotest.RunCommand(t, &app, "deploy", "--zone", "eu")
+
+	if app.Output() != &out || app.ErrorOutput() != &errOut {
+		t.Fatalf("expected custom writers to be restored")
+	}
+
+	if err := app.RunE(); err != nil || errOut.String() != "deploying to us\n" {
+		t.Fatalf("expected the previous arguments to be restored, got %q and %v", errOut.String(), err)
+	}
+}
+
+func TestKommandoInvalidFlagValues(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Values App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "run",
+			Description: "Runs something.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "force", ValueType: "bool"},
+				{Required: &[]bool{false}[0], Name: "since", ValueType: "int"},
+				{Required: &[]bool{false}[0], Name: "ratio", ValueType: "float"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"--force=maybe", `flag --force: expected true or false, got "maybe"`},
+		{"--since=yesterday", `flag --since: expected an integer like 42, got "yesterday"`},
+		{"--ratio=half", `flag --ratio: expected a number like 3.14, got "half"`},
+	}
+
+	for _, tt := range tests {
+		res := kommandotest.RunCommand(t, &app, "run", tt.arg)
+
+		kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+
+		if !strings.Contains(res.Err.Error(), tt.want) {
+			t.Fatalf("expected error containing %q, got %q", tt.want, res.Err)
+		}
+	}
+}
+
+func TestKommandoRejectsCommandWithoutExecute(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Strict App",
+	}
+
+	defer func() {
+		err := recover()
+
+		if err == nil || !strings.Contains(fmt.Sprint(err), `"noop"`) {
+			t.Fatalf("expected a panic naming the command, got %v", err)
+		}
+	}()
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "noop",
+			Description: "Does nothing.",
+		},
+	)
+}
+
+func BenchmarkKommandoCommandLookup(b *testing.B) {
+	app := types.Config{
+		AppName: "Kommando Bench App",
+	}
+
+	for i := 0; i < 300; i++ {
+		app.AddCommand(
+			&types.Command{
+				Name:        fmt.Sprintf("resource-%d", i),
+				Description: "Generated command.",
+				Aliases:     []string{fmt.Sprintf("r%d", i)},
+				Execute:     func(res *types.CmdResponse) {},
+			},
+		)
+	}
+
+	app.SetOutput(io.Discard)
+	app.SetArgs([]string{"r299"})
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		app.Run()
+	}
+}
+
+func TestKommandoFirstRegisteredWins(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Lookup App",
+	}
+
+	var ran string
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "status",
+			Description: "Shows status.",
+			Aliases:     []string{"st"},
+			Execute: func(res *types.CmdResponse) {
+				ran = "status"
+			},
+		},
+	)
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "st",
+			Description: "Shadowed by the alias above.",
+			Execute: func(res *types.CmdResponse) {
+				ran = "st"
+			},
+		},
+	)
+
+	kommandotest.RunCommand(t, &app, "st")
+
+	if ran != "status" {
+		t.Fatalf("expected the first registered match to run, got %q", ran)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "help", "st")
+
+	if !strings.Contains(res.Stdout, "Shadowed by the alias above.") {
+		t.Fatalf("expected help to look up by name only, got %q", res.Stdout)
+	}
+}
+
+func BenchmarkKommandoFlagLookup(b *testing.B) {
+	app := types.Config{
+		AppName: "Kommando Bench App",
+	}
+
+	flags := make([]types.Flag, 100)
+
+	for i := range flags {
+		flags[i] = types.Flag{Required: &[]bool{false}[0], Name: fmt.Sprintf("flag-%d", i), ValueType: "string"}
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "parse",
+			Description: "Parses many flags.",
+			Flags:       flags,
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	args := []string{"parse"}
+
+	for i := 0; i < 1000; i++ {
+		args = append(args, fmt.Sprintf("--flag-%d=value", 99-i%100))
+	}
+
+	app.SetOutput(io.Discard)
+	app.SetArgs(args)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		app.Run()
+	}
+}
+
+func BenchmarkKommandoParseArgs(b *testing.B) {
+	app := types.Config{
+		AppName: "Kommando Bench App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "files",
+			Description: "Takes many file paths.",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	args := []string{"files"}
+
+	for i := 0; i < 10000; i++ {
+		args = append(args, fmt.Sprintf("path/file%d.txt", i))
+	}
+
+	app.SetOutput(io.Discard)
+	app.SetArgs(args)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		app.Run()
+	}
+}
+
+func TestKommandoParse(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Parse App",
+	}
+
+	executed := false
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "greet",
+			Description: "Greets someone.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "times", ValueType: "int"},
+			},
+			Aliases: []string{"g"},
+			Execute: func(res *types.CmdResponse) {
+				executed = true
+			},
+		},
+	)
+
+	res := app.Parse([]string{"g", "--times=3", "world"})
+
+	if res == nil || res.Command.Name != "greet" {
+		t.Fatalf("expected greet to be resolved, got %+v", res)
+	}
+
+	if res.Args["times"] != "3" || strings.Join(res.Args["args"].([]string), " ") != "world" {
+		t.Fatalf("unexpected parse result %v", res.Args)
+	}
+
+	if executed {
+		t.Fatalf("expected Parse not to execute the command")
+	}
+
+	if app.Parse([]string{"unknown"}) != nil || app.Parse(nil) != nil {
+		t.Fatalf("expected nil for unknown or missing commands")
+	}
+}
+
+func TestKommandoErrors(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Errors App",
+	}
+
+	var received map[string]interface{}
+
+	cmd := &types.Command{
+		Name:        "build",
+		Description: "Builds the project.",
+		Flags: []types.Flag{
+			{Required: &[]bool{false}[0], Name: "release", ValueType: "bool"},
+			{Required: &[]bool{false}[0], Name: "jobs", ValueType: "int"},
+			{Required: &[]bool{false}[0], Name: "target", ValueType: "string"},
+		},
+		Execute: func(res *types.CmdResponse) {
+			received = res.Args
+		},
+	}
+
+	if err := app.AddCommandE(cmd); err != nil {
+		t.Fatalf("unexpected error adding command: %v", err)
+	}
+
+	if err := app.AddCommandE(cmd); !errors.Is(err, types.ErrDuplicateCommand) {
+		t.Fatalf("expected ErrDuplicateCommand, got %v", err)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "build", "--jobs=4", "--release")
+
+	if res.Err != nil || received["release"] != "true" || received["jobs"] != "4" {
+		t.Fatalf("expected trailing bool flag to be true, got %v (err %v)", received, res.Err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "build", "--target")
+
+	kommandotest.RequireError(t, res, types.ErrMissingFlagValue)
+
+	res = kommandotest.RunCommand(t, &app, "build", "--jobs=many")
+
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+}
+
+func TestKommandoArgParserPrefixes(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Parser App",
+	}
+
+	var received map[string]interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "copy",
+			Description: "Copies files.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "verbose", ValueType: "bool"},
+				{Required: &[]bool{false}[0], Name: "label", ValueType: "string"},
+				{Required: &[]bool{false}[0], Name: "retries", ValueType: "int"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args
+			},
+		},
+	)
+
+	tests := []struct {
+		args  []string
+		want  string
+		flags map[string]interface{}
+	}{
+		{
+			args: []string{"my-file.txt", "2024-01-02", "out-dir"},
+			want: "my-file.txt 2024-01-02 out-dir",
+		},
+		{
+			args:  []string{"--label", "a-b", "my-file.txt", "-retries", "3"},
+			want:  "my-file.txt",
+			flags: map[string]interface{}{"label": "a-b", "retries": "3"},
+		},
+		{
+			args:  []string{"--label=k=v", "src-file", "--verbose"},
+			want:  "src-file",
+			flags: map[string]interface{}{"label": "k=v", "verbose": "true"},
+		},
+		{
+			args:  []string{"--verbose", "my-file.txt"},
+			want:  "my-file.txt",
+			flags: map[string]interface{}{"verbose": "true"},
+		},
+		{
+			args:  []string{"--verbose", "false", "--", "--label", "-x"},
+			want:  "--label -x",
+			flags: map[string]interface{}{"verbose": "false"},
+		},
+	}
+
+	for _, tt := range tests {
+		res := kommandotest.RunCommand(t, &app, append([]string{"copy"}, tt.args...)...)
+
+		if res.Err != nil {
+			t.Fatalf("%v: unexpected error %v", tt.args, res.Err)
+		}
+
+		if got := strings.Join(received["args"].([]string), " "); got != tt.want {
+			t.Fatalf("%v: expected positionals %q, got %q", tt.args, tt.want, got)
+		}
+
+		for name, value := range tt.flags {
+			if received[name] != value {
+				t.Fatalf("%v: expected --%s=%v, got %v", tt.args, name, value, received[name])
+			}
+		}
+	}
+}
+
+func TestKommandoFlagPattern(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Pattern App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "release",
+			Description: "Cuts a release.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "version", ValueType: "string", Pattern: `^v\d+\.\d+\.\d+$`, PatternDescription: "must look like vX.Y.Z"},
+				{Required: &[]bool{false}[0], Name: "build", ValueType: "int", Pattern: `^\d{3}$`},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	if res := kommandotest.RunCommand(t, &app, "release", "--version", "v1.2.3", "--build=123"); res.Err != nil {
+		t.Fatalf("unexpected error %v", res.Err)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "release", "--version=1.2")
+
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+
+	if !strings.Contains(res.Err.Error(), `must look like vX.Y.Z, got "1.2"`) {
+		t.Fatalf("expected the pattern description in %q", res.Err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "release", "--build=12")
+
+	if !strings.Contains(fmt.Sprint(res.Err), `expected a value matching "^\\d{3}$"`) {
+		t.Fatalf("expected the pattern in %v", res.Err)
+	}
+
+	err := app.AddCommandE(&types.Command{
+		Name: "broken",
+		Flags: []types.Flag{
+			{Name: "tag", ValueType: "string", Pattern: "("},
+		},
+		Execute: func(res *types.CmdResponse) {},
+	})
+
+	if !errors.Is(err, types.ErrInvalidPattern) {
+		t.Fatalf("expected ErrInvalidPattern, got %v", err)
+	}
+}
+
+func TestKommandoAnnotations(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Annotations App",
+	}
+
+	app.AddFlagSet(types.NewFlagSet("auth",
+		types.Flag{Required: &[]bool{false}[0], Name: "token", ValueType: "string"},
+	))
+
+	var seen map[string]string
+
+	base := &types.Command{
+		Name:        "upload",
+		Description: "Uploads a file.",
+		FlagSets:    []string{"auth"},
+		Annotations: map[string]string{"requires-auth": "true", "api-group": "storage"},
+		Execute: func(res *types.CmdResponse) {
+			seen = res.Command.Annotations
+		},
+	}
+
+	clone := base.Clone(func(cmd *types.Command) {
+		cmd.Name = "download"
+		cmd.Annotations["api-group"] = "transfer"
+	})
+
+	app.AddCommand(base)
+	app.AddCommand(clone)
+
+	kommandotest.RunCommand(t, &app, "upload")
+
+	if seen["requires-auth"] != "true" || seen["api-group"] != "storage" {
+		t.Fatalf("expected annotations to reach Execute, got %v", seen)
+	}
+
+	kommandotest.RunCommand(t, &app, "download")
+
+	if seen["requires-auth"] != "true" || seen["api-group"] != "transfer" {
+		t.Fatalf("expected the clone's own annotations, got %v", seen)
+	}
+}
+
+func TestKommandoRawArgs(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Raw App",
+	}
+
+	var res *types.CmdResponse
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "exec",
+			Description: "Runs a program.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "dir", ValueType: "string"},
+			},
+			Aliases: []string{"x"},
+			Execute: func(r *types.CmdResponse) {
+				res = r
+			},
+		},
+	)
+
+	args := []string{"x", "--dir=/tmp", "ls", "--", "-la"}
+
+	kommandotest.RunCommand(t, &app, args...)
+
+	if strings.Join(res.RawArgs, " ") != "x --dir=/tmp ls -- -la" {
+		t.Fatalf("unexpected RawArgs %v", res.RawArgs)
+	}
+
+	if strings.Join(res.RawCommandArgs, " ") != "--dir=/tmp ls -- -la" {
+		t.Fatalf("unexpected RawCommandArgs %v", res.RawCommandArgs)
+	}
+
+	res.RawCommandArgs[0] = "changed"
+
+	if res.RawArgs[1] != "--dir=/tmp" {
+		t.Fatalf("expected RawArgs and RawCommandArgs not to share storage")
+	}
+}
+
+func TestKommandoHiddenAliases(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Hidden Alias App",
+	}
+
+	ran := false
+
+	app.AddCommand(
+		&types.Command{
+			Name:          "remove",
+			Description:   "Removes a resource.",
+			Aliases:       []string{"rm"},
+			HiddenAliases: []string{"delete"},
+			Execute: func(res *types.CmdResponse) {
+				ran = true
+			},
+		},
+	)
+
+	kommandotest.RunCommand(t, &app, "delete")
+
+	if !ran {
+		t.Fatalf("expected the hidden alias to resolve")
+	}
+
+	res := kommandotest.RunCommand(t, &app, "help", "remove")
+
+	if !strings.Contains(res.Stdout, "Aliases |> rm\n") || strings.Contains(res.Stdout, "delete") {
+		t.Fatalf("expected help to omit hidden aliases, got %q", res.Stdout)
+	}
+}
+
+func TestKommandoFlagNormalize(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Normalize App",
+	}
+
+	var region interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{
+					Required:  &[]bool{false}[0],
+					Name:      "region",
+					ValueType: "string",
+					Pattern:   `^[a-z]+-[a-z]+-\d$`,
+					Normalize: func(value string) string {
+						return strings.ToLower(strings.TrimSpace(value))
+					},
+				},
+			},
+			Execute: func(res *types.CmdResponse) {
+				region = res.Args["region"]
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "deploy", "--region", " EU-West-1 ")
+
+	if res.Err != nil || region != "eu-west-1" {
+		t.Fatalf("expected the normalized value to pass validation, got %v (err %v)", region, res.Err)
+	}
+}
+
+func TestKommandoUserAliases(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando User Alias App",
+		UserAliases: map[string][]string{
+			"co":     {"checkout"},
+			"cob":    {"co", "--branch"},
+			"status": {"checkout"},
+			"loop":   {"again"},
+			"again":  {"loop"},
+		},
+	}
+
+	var ran string
+	var branch interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "checkout",
+			Description: "Checks out a branch.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "branch", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				ran, branch = "checkout", res.Args["branch"]
+			},
+		},
+	)
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "status",
+			Description: "Shows status.",
+			Execute: func(res *types.CmdResponse) {
+				ran = "status"
+			},
+		},
+	)
+
+	kommandotest.RunCommand(t, &app, "cob", "feature")
+
+	if ran != "checkout" || branch != "feature" {
+		t.Fatalf("expected chained aliases to expand, got %q with branch %v", ran, branch)
+	}
+
+	kommandotest.RunCommand(t, &app, "status")
+
+	if ran != "status" {
+		t.Fatalf("expected the real command to win over the alias, got %q", ran)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "loop")
+
+	kommandotest.RequireError(t, res, types.ErrRecursiveAlias)
+}
+
+func TestKommandoValidate(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Validate App",
+		UserAliases: map[string][]string{
+			"up": {"start"},
+		},
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "start",
+			Description: "Starts the server.",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	if err := app.Validate(); err != nil {
+		t.Fatalf("expected a valid app, got %v", err)
+	}
+
+	app.UserAliases["a"] = []string{"b"}
+	app.UserAliases["b"] = []string{"a"}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "stop",
+			Description: "Stops the server.",
+			Aliases:     []string{"start"},
+			Flags: []types.Flag{
+				{Name: "force", ValueType: "bool"},
+				{Name: "force", ValueType: "bool"},
+				{Name: "", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	err := app.Validate()
+
+	var verr *types.ValidationError
+
+	if !errors.As(err, &verr) || len(verr.Problems) != 5 {
+		t.Fatalf("expected five problems, got %v", err)
+	}
+
+	for _, target := range []error{types.ErrDuplicateAlias, types.ErrDuplicateFlag, types.ErrEmptyName, types.ErrRecursiveAlias} {
+		if !errors.Is(err, target) {
+			t.Fatalf("expected %v to match %v", err, target)
+		}
+	}
+
+	if !strings.Contains(err.Error(), `command "stop": alias is already in use: "start" is also used by "start"`) {
+		t.Fatalf("expected problems to name the command, got %q", err)
+	}
+}
+
+func TestKommandoCommandAbbreviations(t *testing.T) {
+	app := types.Config{
+		AppName:              "Kommando Abbreviation App",
+		CommandAbbreviations: true,
+	}
+
+	var ran string
+
+	for _, name := range []string{"status", "start", "stash"} {
+		name := name
+
+		app.AddCommand(
+			&types.Command{
+				Name:        name,
+				Description: "Generated command.",
+				Execute: func(res *types.CmdResponse) {
+					ran = res.Command.Name
+				},
+			},
+		)
+	}
+
+	kommandotest.RunCommand(t, &app, "stat")
+
+	if ran != "status" {
+		t.Fatalf("expected the unique prefix to resolve to status, got %q", ran)
+	}
+
+	kommandotest.RunCommand(t, &app, "start")
+
+	if ran != "start" {
+		t.Fatalf("expected an exact match to win, got %q", ran)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "sta")
+
+	kommandotest.RequireError(t, res, types.ErrAmbiguousCommand)
+
+	if !strings.Contains(res.Err.Error(), "start, stash, status") {
+		t.Fatalf("expected the candidates to be listed, got %q", res.Err)
+	}
+
+	app.CommandAbbreviations = false
+	ran = ""
+
+	res = kommandotest.RunCommand(t, &app, "stat")
+
+	if ran != "" || !errors.Is(res.Err, types.ErrCommandNotFound) {
+		t.Fatalf("expected abbreviations to be off, got %q (err %v)", ran, res.Err)
+	}
+}
+
+type recordingTelemetry struct {
+	events []string
+}
+
+func (r *recordingTelemetry) OnCommandStart(path []string, res *types.CmdResponse) {
+	r.events = append(r.events, "start "+strings.Join(path, " "))
+
+	panic("telemetry handlers must not affect the run")
+}
+
+func (r *recordingTelemetry) OnCommandEnd(path []string, err error, duration time.Duration) {
+	r.events = append(r.events, fmt.Sprintf("end %s %v", strings.Join(path, " "), err != nil))
+}
+
+func TestKommandoTelemetry(t *testing.T) {
+	telemetry := &recordingTelemetry{}
+
+	app := types.Config{
+		AppName:   "Kommando Telemetry App",
+		Telemetry: telemetry,
+	}
+
+	ran := false
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "sync",
+			Description: "Syncs data.",
+			Execute: func(res *types.CmdResponse) {
+				ran = true
+			},
+		},
+	)
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "crash",
+			Description: "Always panics.",
+			Execute: func(res *types.CmdResponse) {
+				panic("boom")
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "sync")
+
+	if !ran || res.Err != nil || res.Panic != nil {
+		t.Fatalf("expected sync to run despite the panicking handler, got %+v", res)
+	}
+
+	kommandotest.RunCommand(t, &app, "help", "sync")
+	kommandotest.RunCommand(t, &app)
+
+	res = kommandotest.RunCommand(t, &app, "crash")
+
+	kommandotest.RequirePanic(t, res, "boom")
+
+	errGuarded := errors.New("guarded")
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "guarded",
+			Description: "Always refused by its Before hook.",
+			Before: func(res *types.CmdResponse) error {
+				return errGuarded
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	res = kommandotest.RunCommand(t, &app, "guarded")
+
+	kommandotest.RequireError(t, res, errGuarded)
+
+	want := "start sync|end sync false|start crash|end crash true|start guarded|end guarded true"
+
+	if got := strings.Join(telemetry.events, "|"); got != want {
+		t.Fatalf("expected events %q, got %q", want, got)
+	}
+}
+
+func TestKommandoCommandsCommand(t *testing.T) {
+	app := types.Config{
+		AppName:         "Kommando Listing App",
+		CommandsCommand: true,
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{Required: &[]bool{true}[0], Name: "zone", Description: "Target zone.", ValueType: "string"},
+			},
+			Aliases: []string{"d"},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "commands")
+
+	if !strings.HasPrefix(res.Stdout, "deploy (d) |> Deploys the app.\n  --zone <string> (required) |> Target zone.\nhelp |> ") {
+		t.Fatalf("unexpected text listing %q", res.Stdout)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "commands", "--format", "json")
+
+	var listing []struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+		Flags   []struct {
+			Name     string `json:"name"`
+			Required bool   `json:"required"`
+		} `json:"flags"`
+	}
+
+	if err := json.Unmarshal([]byte(res.Stdout), &listing); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", res.Stdout, err)
+	}
+
+	if len(listing) != 3 || listing[0].Name != "deploy" || listing[0].Aliases[0] != "d" || !listing[0].Flags[0].Required {
+		t.Fatalf("unexpected JSON listing %+v", listing)
+	}
+
+	again := kommandotest.RunCommand(t, &app, "commands", "--format=json")
+
+	if again.Stdout != res.Stdout {
+		t.Fatalf("expected deterministic JSON output")
+	}
+
+	res = kommandotest.RunCommand(t, &app, "commands", "--format=yaml")
+
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+}
+
+func TestKommandoPrintHelp(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Print App",
+	}
+
+	var out bytes.Buffer
+
+	cmd := &types.Command{
+		Name:        "lint",
+		Description: "Lints the code.",
+		Flags: []types.Flag{
+			{Required: &[]bool{false}[0], Name: "fix", ValueType: "bool"},
+		},
+		Aliases: []string{"l"},
+		Execute: func(res *types.CmdResponse) {
+			if res.Args["fix"] == nil {
+				app.PrintCommandHelp(&res.Command)
+			}
+		},
+	}
+
+	app.AddCommand(cmd)
+
+	help := kommandotest.RunCommand(t, &app, "help", "lint")
+	fromExecute := kommandotest.RunCommand(t, &app, "lint")
+
+	if help.Stdout != fromExecute.Stdout || help.Stdout == "" {
+		t.Fatalf("expected PrintCommandHelp to match 'help lint', got %q and %q", fromExecute.Stdout, help.Stdout)
+	}
+
+	list := kommandotest.RunCommand(t, &app)
+
+	app.SetOutput(&out)
+	app.PrintHelp()
+
+	if out.String() != list.Stdout {
+		t.Fatalf("expected PrintHelp to match the command list, got %q and %q", out.String(), list.Stdout)
+	}
+}
+
+func TestKommandoFlagConstructors(t *testing.T) {
+	tests := []struct {
+		got  types.Flag
+		want types.Flag
+	}{
+		{
+			got:  StringFlag("name", "Who to greet."),
+			want: types.Flag{Required: &[]bool{false}[0], Name: "name", Description: "Who to greet.", ValueType: "string"},
+		},
+		{
+			got:  BoolFlag("force", "Skip checks.", WithRequired()),
+			want: types.Flag{Required: &[]bool{true}[0], Name: "force", Description: "Skip checks.", ValueType: "bool"},
+		},
+		{
+			got:  IntFlag("jobs", "Parallel jobs."),
+			want: types.Flag{Required: &[]bool{false}[0], Name: "jobs", Description: "Parallel jobs.", ValueType: "int"},
+		},
+		{
+			got:  FloatFlag("ratio", "Sample ratio.", WithPattern(`^0\.\d+$`, "must be below 1")),
+			want: types.Flag{Required: &[]bool{false}[0], Name: "ratio", Description: "Sample ratio.", ValueType: "float", Pattern: `^0\.\d+$`, PatternDescription: "must be below 1"},
+		},
+		{
+			got:  BoolFlag("debug", "Internal tracing.", WithHidden()),
+			want: types.Flag{Required: &[]bool{false}[0], Name: "debug", Description: "Internal tracing.", ValueType: "bool", Hidden: true},
+		},
+	}
+
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Fatalf("expected %+v, got %+v", tt.want, tt.got)
+		}
+	}
+
+	app := NewKommando(types.Config{
+		AppName: "Kommando Constructor App",
+	})
+
+	var region interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				StringFlag("region", "Target region.", WithRequired(), WithNormalize(strings.ToLower)),
+			},
+			Execute: func(res *types.CmdResponse) {
+				region = res.Args["region"]
+			},
+		},
+	)
+
+	if res := kommandotest.RunCommand(t, &app, "deploy", "--region=EU"); res.Err != nil || region != "eu" {
+		t.Fatalf("expected the constructed flag to parse, got %v (err %v)", region, res.Err)
+	}
+
+	kommandotest.RequireError(t, kommandotest.RunCommand(t, &app, "deploy"), types.ErrRequiredFlag)
+}
+
+func TestKommandoUsageLine(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Usage App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "run",
+			Description: "Runs the app.",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app)
+
+	if strings.Contains(res.Stdout, "Usage:") {
+		t.Fatalf("expected no usage line by default, got %q", res.Stdout)
+	}
+
+	app.Usage = "usageapp <command> [args]"
+
+	res = kommandotest.RunCommand(t, &app)
+
+	want := "Welcome to Kommando Usage App! That's a command list. Type 'help <command name>' to get help with any command.\n" +
+		"Usage: usageapp <command> [args]\n" +
+		"run |> Runs the app.\n"
+
+	if !strings.HasPrefix(res.Stdout, want) {
+		t.Fatalf("expected %q, got %q", want, res.Stdout)
+	}
+}
+
+func TestKommandoResponseFiles(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args.txt")
+	nested := filepath.Join(dir, "nested.txt")
+
+	if err := os.WriteFile(args, []byte("# generated by the build\nbuild --label \"release build\"\n  'src dir' main.go\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(nested, []byte("build @"+args+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := types.Config{
+		AppName:       "Kommando Response App",
+		ResponseFiles: true,
+	}
+
+	var received map[string]interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "build",
+			Description: "Builds sources.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "label", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "@"+args, "extra", "--", "@literal")
+
+	if res.Err != nil || received["label"] != "release build" {
+		t.Fatalf("expected the response file to expand, got %v (err %v)", received, res.Err)
+	}
+
+	if got := strings.Join(received["args"].([]string), "|"); got != "src dir|main.go|extra|@literal" {
+		t.Fatalf("unexpected positionals %q", got)
+	}
+
+	kommandotest.RequireError(t, kommandotest.RunCommand(t, &app, "@"+nested), types.ErrResponseFile)
+	kommandotest.RequireError(t, kommandotest.RunCommand(t, &app, "@"+filepath.Join(dir, "missing.txt")), types.ErrResponseFile)
+}
+
+func TestKommandoBareDash(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Dash App",
+	}
+
+	var received map[string]interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "cat",
+			Description: "Prints files.",
+			Flags: []types.Flag{
+				{Required: &[]bool{false}[0], Name: "verbose", ValueType: "bool"},
+				{Required: &[]bool{false}[0], Name: "output", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "cat", "-", "--verbose")
+
+	if res.Err != nil || strings.Join(received["args"].([]string), " ") != "-" || received["verbose"] != "true" {
+		t.Fatalf("expected \"-\" to be positional, got %v (err %v)", received, res.Err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "cat", "--output", "-", "a.txt")
+
+	if res.Err != nil || received["output"] != "-" || strings.Join(received["args"].([]string), " ") != "a.txt" {
+		t.Fatalf("expected \"-\" to be usable as a flag value, got %v (err %v)", received, res.Err)
+	}
+}
+
+func TestKommandoDisableFlagParsing(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Passthrough App",
+	}
+
+	var received map[string]interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "kubectl",
+			Description: "Runs kubectl with the given arguments.",
+			Flags: []types.Flag{
+				{Required: &[]bool{true}[0], Name: "context", ValueType: "string"},
+			},
+			DisableFlagParsing: true,
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args
+			},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "kubectl", "get", "pods", "-n", "--context=prod", "--", "--help")
+
+	if res.Err != nil || len(received) != 1 {
+		t.Fatalf("expected only positional args, got %v (err %v)", received, res.Err)
+	}
+
+	if got := strings.Join(received["args"].([]string), " "); got != "get pods -n --context=prod -- --help" {
+		t.Fatalf("expected args verbatim, got %q", got)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "kubectl")
+
+	if !strings.Contains(res.Stdout, "kubectl | Info") {
+		t.Fatalf("expected help to stay reachable, got %q", res.Stdout)
+	}
+}
+
+func TestKommandoSuggestFor(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Suggest App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "delete",
+			Description: "Deletes a resource.",
+			SuggestFor:  []string{"remove", "rm"},
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	res := kommandotest.RunCommand(t, &app, "remove")
+
+	kommandotest.RequireError(t, res, types.ErrCommandNotFound)
+
+	if code := types.ExitCode(res.Err); code != 2 {
+		t.Fatalf("expected exit code 2 for an unknown command, got %d", code)
+	}
+
+	if res.Stdout != "" || !strings.HasPrefix(res.Stderr, "Unknown command 'remove'. Did you mean 'delete'?\nWelcome to") {
+		t.Fatalf("expected a suggestion above the command list on stderr, got %q", res.Stderr)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "rm")
+
+	if !strings.HasPrefix(res.Stdout, "Unknown command 'rm'. Did you mean 'delete'?\n") {
+		t.Fatalf("expected help to suggest too, got %q", res.Stdout)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "unrelated")
+
+	if strings.Contains(res.Stderr, "Did you mean") {
+		t.Fatalf("expected no suggestion, got %q", res.Stderr)
+	}
+}
+
+type testSemver struct {
+	Major, Minor, Patch int
+}
+
+func TestKommandoRegisterFlagType(t *testing.T) {
+	err := types.RegisterFlagType("semver", func(value string) (interface{}, error) {
+		var v testSemver
+
+		if _, err := fmt.Sscanf(value, "v%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+			return nil, err
+		}
+
+		return v, nil
+	})
+
+	if err != nil && !errors.Is(err, types.ErrFlagTypeExists) {
+		t.Fatalf("unexpected error registering semver: %v", err)
+	}
+
+	if err := types.RegisterFlagType("semver", nil); !errors.Is(err, types.ErrFlagTypeExists) {
+		t.Fatalf("expected a duplicate registration to fail, got %v", err)
+	}
+
+	if err := types.RegisterFlagType("int", nil); !errors.Is(err, types.ErrFlagTypeExists) {
+		t.Fatalf("expected a built-in name to be rejected, got %v", err)
+	}
+
+	if err := types.RegisterFlagType("nilparser", nil); !errors.Is(err, types.ErrInvalidFlagType) {
+		t.Fatalf("expected a nil parser to be rejected, got %v", err)
+	}
+
+	app := types.Config{
+		AppName: "Kommando Flag Type App",
+	}
+
+	var version interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "release",
+			Description: "Cuts a release.",
+			Flags: []types.Flag{
+				{Required: &[]bool{true}[0], Name: "version", ValueType: "semver"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				version = res.Args["version"]
+			},
+		},
+	)
+
+	if res := kommandotest.RunCommand(t, &app, "release", "--version", "v1.4.2"); res.Err != nil {
+		t.Fatalf("unexpected error %v", res.Err)
+	}
+
+	if version != (testSemver{1, 4, 2}) {
+		t.Fatalf("expected the parsed value, got %#v", version)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "release", "--version=latest")
+
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+
+	if !strings.Contains(res.Err.Error(), `flag --version: expected a valid semver, got "latest"`) {
+		t.Fatalf("unexpected error message %q", res.Err)
+	}
+}
+
+type testContextKey struct{}
+
+func TestKommandoRunContext(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Context App",
+	}
+
+	var value interface{}
+	var err error
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "fetch",
+			Description: "Fetches data.",
+			Execute: func(res *types.CmdResponse) {
+				value = res.Context().Value(testContextKey{})
+				err = res.Context().Err()
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "request-1"))
+	cancel()
+
+	app.SetOutput(io.Discard)
+	app.SetArgs([]string{"fetch"})
+
+	if runErr := app.RunContext(ctx); runErr != nil {
+		t.Fatalf("unexpected error %v", runErr)
+	}
+
+	if value != "request-1" || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the caller's context, got value %v and err %v", value, err)
+	}
+
+	kommandotest.RunCommand(t, &app, "fetch")
+
+	if value != nil || err != nil {
+		t.Fatalf("expected a background context from RunE, got value %v and err %v", value, err)
+	}
+}
+
+func TestKommandoCancelSignals(t *testing.T) {
+	app := types.Config{
+		AppName:       "Kommando Signal App",
+		CancelSignals: []os.Signal{os.Interrupt},
+	}
+
+	var err error
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "wait",
+			Description: "Waits for cancellation.",
+			Execute: func(res *types.CmdResponse) {
+				process, _ := os.FindProcess(os.Getpid())
+
+				if signalErr := process.Signal(os.Interrupt); signalErr != nil {
+					t.Skipf("cannot send an interrupt on this platform: %v", signalErr)
+				}
+
+				select {
+				case <-res.Context().Done():
+					err = res.Context().Err()
+				case <-time.After(5 * time.Second):
+				}
+			},
+		},
+	)
+
+	kommandotest.RunCommand(t, &app, "wait")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the interrupt to cancel the context, got %v", err)
+	}
+}
+
+func TestKommandoArgsValidation(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Args Validation App",
+	}
+
+	errOdd := errors.New("expected an even number of arguments")
+
+	ran := 0
+
+	for _, cmd := range []*types.Command{
+		{Name: "range", ArgsMin: 1, ArgsMax: 2},
+		{Name: "min", ArgsMin: 2},
+		{Name: "exact", ArgsMin: 1, ArgsMax: 1},
+		{Name: "pairs", ArgsMin: 5, ArgsValidator: func(args []string) error {
+			if len(args)%2 != 0 {
+				return errOdd
+			}
+
+			return nil
+		}},
+	} {
+		cmd.Description = "Generated command."
+		cmd.Execute = func(res *types.CmdResponse) {
+			ran++
+		}
+
+		app.AddCommand(cmd)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"range", "a"}, ""},
+		{[]string{"range", "a", "b"}, ""},
+		{[]string{"range"}, "invalid arguments: range: expected between 1 and 2 arguments, got 0"},
+		{[]string{"range", "a", "b", "c"}, "invalid arguments: range: expected between 1 and 2 arguments, got 3"},
+		{[]string{"min", "a"}, "invalid arguments: min: expected at least 2 arguments, got 1"},
+		{[]string{"exact", "a", "b"}, "invalid arguments: exact: expected exactly 1 argument, got 2"},
+		{[]string{"pairs", "a", "b"}, ""},
+		{[]string{"pairs", "a"}, "invalid arguments: pairs: expected an even number of arguments"},
+	}
+
+	for _, tt := range tests {
+		before := ran
+		res := kommandotest.RunCommand(t, &app, tt.args...)
+
+		if tt.want == "" {
+			if res.Err != nil || ran != before+1 {
+				t.Fatalf("%v: expected the command to run, got %v", tt.args, res.Err)
+			}
+
+			continue
+		}
+
+		kommandotest.RequireError(t, res, types.ErrInvalidArgs)
+
+		if res.Err.Error() != tt.want || ran != before {
+			t.Fatalf("%v: expected %q without running, got %q", tt.args, tt.want, res.Err)
+		}
+	}
+
+	res := kommandotest.RunCommand(t, &app, "pairs", "a")
+
+	if !errors.Is(res.Err, errOdd) {
+		t.Fatalf("expected the validator's error to be preserved, got %v", res.Err)
+	}
+
+	var argsErr *types.InvalidArgsError
+
+	if !errors.As(res.Err, &argsErr) || argsErr.Command != "pairs" || argsErr.Got != 1 || argsErr.Min != 5 {
+		t.Fatalf("expected the validator's error to carry the counts, got %+v", argsErr)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "range", "a", "b", "c")
+
+	if !errors.As(res.Err, &argsErr) || argsErr.Command != "range" || argsErr.Got != 3 || argsErr.Min != 1 || argsErr.Max != 2 {
+		t.Fatalf("expected the counts to be exposed, got %+v", argsErr)
+	}
+
+	err := app.AddCommandE(&types.Command{
+		Name:        "inverted",
+		Description: "Generated command.",
+		ArgsMin:     3,
+		ArgsMax:     2,
+		Execute:     func(res *types.CmdResponse) {},
+	})
+
+	if !errors.As(err, &argsErr) || argsErr.Min != 3 || argsErr.Max != 2 {
+		t.Fatalf("expected ArgsMin above ArgsMax to be rejected, got %v", err)
+	}
+}
+
+func TestKommandoShortFlagGroups(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Short Flags App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "rm",
+			Description: "Removes files.",
+			Flags: []types.Flag{
+				{Name: "r", ValueType: "bool"},
+				{Name: "f", ValueType: "bool"},
+				{Name: "o", ValueType: "string"},
+				{Name: "rf", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	tests := []struct {
+		args []string
+		want map[string]interface{}
+	}{
+		{[]string{"rm", "-fr", "a"}, map[string]interface{}{"f": "true", "r": "true", "args": []string{"a"}}},
+		{[]string{"rm", "-rfo", "out.txt", "a"}, map[string]interface{}{"f": "true", "r": "true", "o": "out.txt", "args": []string{"a"}}},
+		{[]string{"rm", "-rf", "x"}, map[string]interface{}{"rf": "x", "args": []string{}}},
+		{[]string{"rm", "-or", "a"}, map[string]interface{}{"args": []string{}}},
+		{[]string{"rm", "-rz", "a"}, map[string]interface{}{"args": []string{}}},
+	}
+
+	for _, tt := range tests {
+		res, err := app.ParseE(tt.args)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", tt.args, err)
+		}
+
+		if !reflect.DeepEqual(res.Args, tt.want) {
+			t.Fatalf("%v: expected %v, got %v", tt.args, tt.want, res.Args)
+		}
+	}
+}
+
+func TestKommandoNegativeNumbers(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Negative Numbers App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "add",
+			Description: "Adds numbers.",
+			Flags: []types.Flag{
+				{Name: "offset", ValueType: "int"},
+				{Name: "scale", ValueType: "float"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "pick",
+			Description: "Picks a column.",
+			Flags: []types.Flag{
+				{Name: "2", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	tests := []struct {
+		args []string
+		want map[string]interface{}
+	}{
+		{[]string{"add", "-5", "3"}, map[string]interface{}{"args": []string{"-5", "3"}}},
+		{[]string{"add", "-1.5", "-0.25"}, map[string]interface{}{"args": []string{"-1.5", "-0.25"}}},
+		{[]string{"add", "--offset", "-10", "-3"}, map[string]interface{}{"offset": "-10", "args": []string{"-3"}}},
+		{[]string{"add", "--scale=-2.5", "1"}, map[string]interface{}{"scale": "-2.5", "args": []string{"1"}}},
+		{[]string{"add", "--verbose", "-7"}, map[string]interface{}{"args": []string{"-7"}}},
+		{[]string{"pick", "-2", "-3"}, map[string]interface{}{"2": "true", "args": []string{"-3"}}},
+	}
+
+	for _, tt := range tests {
+		res, err := app.ParseE(tt.args)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", tt.args, err)
+		}
+
+		if !reflect.DeepEqual(res.Args, tt.want) {
+			t.Fatalf("%v: expected %v, got %v", tt.args, tt.want, res.Args)
+		}
+	}
+}
+
+func TestKommandoTypoSuggestions(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Typo App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "server",
+			Description: "Starts the server.",
+			Aliases:     []string{"daemon"},
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "status",
+			Description: "Shows the status.",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"serve"}, "Unknown command 'serve'. Did you mean 'server'?\n"},
+		{[]string{"stats"}, "Unknown command 'stats'. Did you mean 'status'?\n"},
+		{[]string{"deamon"}, "Unknown command 'deamon'. Did you mean 'server'?\n"},
+		{[]string{"help", "Serve"}, "Unknown command 'Serve'. Did you mean 'server'?\n"},
+	}
+
+	for _, tt := range tests {
+		res := kommandotest.RunCommand(t, &app, tt.args...)
+		out := res.Stderr
+
+		if tt.args[0] == "help" {
+			out = res.Stdout
+		}
+
+		if !strings.HasPrefix(out, tt.want) {
+			t.Fatalf("%v: expected %q, got %q", tt.args, tt.want, out)
+		}
+	}
+
+	res := kommandotest.RunCommand(t, &app, "deploy")
+
+	if strings.Contains(res.Stderr, "Did you mean") {
+		t.Fatalf("expected no suggestion for a distant name, got %q", res.Stderr)
+	}
+
+	app.DisableSuggestions = true
+	res = kommandotest.RunCommand(t, &app, "serve")
+
+	if strings.Contains(res.Stderr, "Did you mean") {
+		t.Fatalf("expected suggestions to be disabled, got %q", res.Stderr)
+	}
+}
+
+func TestKommandoHooks(t *testing.T) {
+	var calls []string
+
+	hook := func(name string, err error) func(res *types.CmdResponse) error {
+		return func(res *types.CmdResponse) error {
+			calls = append(calls, name)
+
+			return err
+		}
+	}
+
+	errBefore := errors.New("before failed")
+	errAfter := errors.New("after failed")
+
+	tests := []struct {
+		name       string
+		app        types.Config
+		cmd        types.Command
+		wantErr    error
+		wantCalls  string
+		wantPanics bool
+	}{
+		{
+			name:      "order",
+			app:       types.Config{Before: hook("app-before", nil), After: hook("app-after", nil)},
+			cmd:       types.Command{Before: hook("cmd-before", nil), After: hook("cmd-after", nil)},
+			wantCalls: "app-before cmd-before execute cmd-after app-after",
+		},
+		{
+			name:      "app before fails",
+			app:       types.Config{Before: hook("app-before", errBefore), After: hook("app-after", nil)},
+			cmd:       types.Command{Before: hook("cmd-before", nil), After: hook("cmd-after", nil)},
+			wantErr:   errBefore,
+			wantCalls: "app-before",
+		},
+		{
+			name:      "command before fails",
+			app:       types.Config{Before: hook("app-before", nil), After: hook("app-after", nil)},
+			cmd:       types.Command{Before: hook("cmd-before", errBefore), After: hook("cmd-after", nil)},
+			wantErr:   errBefore,
+			wantCalls: "app-before cmd-before app-after",
+		},
+		{
+			name:      "after fails",
+			app:       types.Config{After: hook("app-after", nil)},
+			cmd:       types.Command{After: hook("cmd-after", errAfter)},
+			wantErr:   errAfter,
+			wantCalls: "execute cmd-after app-after",
+		},
+		{
+			name:       "execute panics",
+			app:        types.Config{After: hook("app-after", nil)},
+			cmd:        types.Command{After: hook("cmd-after", nil)},
+			wantCalls:  "execute cmd-after app-after",
+			wantPanics: true,
+		},
+	}
+
+	for _, tt := range tests {
+		calls = nil
+
+		app := tt.app
+		app.AppName = "Kommando Hooks App"
+
+		cmd := tt.cmd
+		cmd.Name = "run"
+		cmd.Description = "Runs the hooks."
+		cmd.Execute = func(res *types.CmdResponse) {
+			calls = append(calls, "execute")
+
+			if tt.wantPanics {
+				panic("boom")
+			}
+		}
+
+		app.AddCommand(&cmd)
+
+		res := kommandotest.RunCommand(t, &app, "run")
+
+		if !errors.Is(res.Err, tt.wantErr) || (tt.wantErr == nil && res.Err != nil) {
+			t.Fatalf("%s: expected error %v, got %v", tt.name, tt.wantErr, res.Err)
+		}
+
+		if (res.Panic != nil) != tt.wantPanics {
+			t.Fatalf("%s: unexpected panic %v", tt.name, res.Panic)
+		}
+
+		if got := strings.Join(calls, " "); got != tt.wantCalls {
+			t.Fatalf("%s: expected calls %q, got %q", tt.name, tt.wantCalls, got)
+		}
+	}
+
+	calls = nil
+
+	app := types.Config{
+		AppName: "Kommando Hooks App",
+		Before:  hook("app-before", nil),
+	}
+
+	kommandotest.RunCommand(t, &app, "help")
+
+	if len(calls) != 0 {
+		t.Fatalf("expected built-in commands to skip hooks, got %v", calls)
+	}
+}
+
+func TestKommandoUnknownFlags(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Unknown Flags App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "wrap",
+			Description: "Wraps another tool.",
+			Flags: []types.Flag{
+				{Name: "verbose", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	res, err := app.ParseE([]string{"wrap", "--foo=bar", "-x", "val", "--verbose", "--dry-run", "file", "--force", "--", "--after"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	wantFlags := map[string]string{"foo": "bar", "x": "val", "dry-run": "file", "force": ""}
+	wantArgs := []string{"--foo=bar", "-x", "val", "--dry-run", "file", "--force"}
+
+	if !reflect.DeepEqual(res.UnknownFlags, wantFlags) {
+		t.Fatalf("expected unknown flags %v, got %v", wantFlags, res.UnknownFlags)
+	}
+
+	if !reflect.DeepEqual(res.UnknownArgs, wantArgs) {
+		t.Fatalf("expected unknown args %q, got %q", wantArgs, res.UnknownArgs)
+	}
+
+	if res.Args["verbose"] != "true" || !reflect.DeepEqual(res.Args["args"], []string{"--after"}) {
+		t.Fatalf("expected declared flags and positionals to be unaffected, got %v", res.Args)
+	}
+
+	res, err = app.ParseE([]string{"wrap", "--verbose"})
+	if err != nil || res.UnknownFlags != nil || res.UnknownArgs != nil {
+		t.Fatalf("expected no unknown flags, got %v, %v, %v", res.UnknownFlags, res.UnknownArgs, err)
+	}
+}
+
+func TestKommandoFlagAllowed(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Allowed App",
+	}
+
+	var format interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "export",
+			Description: "Exports data.",
+			Flags: []types.Flag{
+				StringFlag("format", "Output format.", WithAllowed("json", "yaml", "table")),
+				StringFlag("sort", "Sort order.", WithAllowed("asc", "desc"), WithAllowedIgnoreCase()),
+			},
+			Execute: func(res *types.CmdResponse) {
+				format = res.Args["format"]
+			},
+		},
+	)
+
+	if res := kommandotest.RunCommand(t, &app, "export", "--format", "yaml"); res.Err != nil || format != "yaml" {
+		t.Fatalf("expected yaml to be accepted, got %v and %v", format, res.Err)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "export", "--format", "JSON")
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+
+	if want := `invalid flag value: flag --format: expected one of json, yaml, table, got "JSON"`; res.Err.Error() != want {
+		t.Fatalf("expected %q, got %q", want, res.Err)
+	}
+
+	parsed, err := app.ParseE([]string{"export", "--sort=DESC"})
+	if err != nil || parsed.Args["sort"] != "desc" {
+		t.Fatalf("expected a case-insensitive match stored as desc, got %v and %v", parsed, err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "export")
+
+	if !strings.Contains(res.Stdout, "--format <json|yaml|table>, --sort <asc|desc>") {
+		t.Fatalf("expected help to list the choices, got %q", res.Stdout)
+	}
+}
+
+func TestKommandoCommandUsageAndExample(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Usage App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys an environment.",
+			Usage:       "deploy [flags] <env>",
+			Example: `
+		deploy staging
+		deploy production \
+			--force
+`,
+			Flags: []types.Flag{
+				{Name: "force", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "copy",
+			Description: "Copies files.",
+			Flags: []types.Flag{
+				{Name: "recursive", ValueType: "bool"},
+			},
+			ArgsMin: 2,
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "status",
+			Description: "Shows the status.",
+			ArgsMax:     1,
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "echo",
+			Description: "Prints its arguments.",
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "pairs",
+			Description: "Takes arguments in pairs.",
+			ArgsMin:     2,
+			ArgsMax:     4,
+			ArgsValidator: func(args []string) error {
+				return nil
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	program := app.AppName
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"deploy", "deploy | Info\nUsage: " + program + " deploy [flags] <env>\nDescription |> Deploys an environment.\nFlags |> --force, --help\nAliases |> \nExamples:\n  deploy staging\n  deploy production \\\n  \t--force\n"},
+		{"copy", "copy | Info\nUsage: " + program + " copy [flags] <arg> <arg> [arg...]\nDescription |> Copies files.\nFlags |> --recursive, --help\nAliases |> \n"},
+		{"status", "status | Info\nUsage: " + program + " status [arg]\nDescription |> Shows the status.\nFlags |> --help\nAliases |> \n"},
+		{"echo", "echo | Info\nUsage: " + program + " echo [args...]\nDescription |> Prints its arguments.\nFlags |> --help\nAliases |> \n"},
+		{"pairs", "pairs | Info\nUsage: " + program + " pairs [args...]\nDescription |> Takes arguments in pairs.\nFlags |> --help\nAliases |> \n"},
+	}
+
+	for _, tt := range tests {
+		res := kommandotest.RunCommand(t, &app, "help", tt.name)
+
+		if res.Stdout != tt.want {
+			t.Fatalf("%s: expected %q, got %q", tt.name, tt.want, res.Stdout)
+		}
+	}
+}
+
+func TestKommandoBind(t *testing.T) {
+	type greetOptions struct {
+		Name    string        `kommando:"name,default=World,desc=who to greet, politely"`
+		Times   int           `kommando:"times,required"`
+		Loud    bool          `kommando:"loud"`
+		Ratio   float64       `kommando:"ratio"`
+		Tags    []string      `kommando:"tags"`
+		Timeout time.Duration `kommando:"timeout,env=KOMMANDO_TEST_TIMEOUT"`
+		Big     int64         `kommando:",default=7"`
+		Ignored string
+	}
+
+	flags := FlagsFromStruct(&greetOptions{})
+
+	want := []string{"name:string:false:who to greet, politely", "times:int:true:", "loud:bool:false:", "ratio:float:false:", "tags:string:false:", "timeout:string:false:", "big:int:false:"}
+	got := make([]string, len(flags))
+
+	for i, flag := range flags {
+		got[i] = fmt.Sprintf("%s:%s:%t:%s", flag.Name, flag.ValueType, *flag.Required, flag.Description)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected flags %q, got %q", want, got)
+	}
+
+	app := types.Config{
+		AppName: "Kommando Bind App",
+	}
+
+	var opts greetOptions
+	var bindErr error
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "greet",
+			Description: "Greets someone.",
+			Flags:       flags,
+			Execute: func(res *types.CmdResponse) {
+				opts = greetOptions{}
+				bindErr = res.Bind(&opts)
+			},
+		},
+	)
+
+	t.Setenv("KOMMANDO_TEST_TIMEOUT", "1m30s")
+
+	kommandotest.RunCommand(t, &app, "greet", "--times", "3", "--loud", "--ratio=0.5", "--tags", "a,b")
+
+	wantOpts := greetOptions{Name: "World", Times: 3, Loud: true, Ratio: 0.5, Tags: []string{"a", "b"}, Timeout: 90 * time.Second, Big: 7}
+
+	if bindErr != nil || !reflect.DeepEqual(opts, wantOpts) {
+		t.Fatalf("expected %+v, got %+v and %v", wantOpts, opts, bindErr)
+	}
+
+	kommandotest.RunCommand(t, &app, "greet", "--times", "1", "--timeout", "soon")
+
+	if !errors.Is(bindErr, types.ErrInvalidFlagValue) {
+		t.Fatalf("expected an invalid duration to fail, got %v", bindErr)
+	}
+
+	type paintOptions struct {
+		Color string `kommando:"color,env=KOMMANDO_TEST_COLOR"`
+	}
+
+	var paint paintOptions
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "paint",
+			Description: "Paints something.",
+			Flags: []types.Flag{
+				{Name: "color", ValueType: "string", Normalize: strings.ToLower, Allowed: []string{"red", "blue"}},
+			},
+			Execute: func(res *types.CmdResponse) {
+				paint = paintOptions{}
+				bindErr = res.Bind(&paint)
+			},
+		},
+	)
+
+	t.Setenv("KOMMANDO_TEST_COLOR", "BLUE")
+	kommandotest.RunCommand(t, &app, "paint")
+
+	if bindErr != nil || paint.Color != "blue" {
+		t.Fatalf("expected the env value to be normalized, got %q and %v", paint.Color, bindErr)
+	}
+
+	t.Setenv("KOMMANDO_TEST_COLOR", "green")
+	kommandotest.RunCommand(t, &app, "paint")
+
+	if !errors.Is(bindErr, types.ErrInvalidFlagValue) || paint.Color != "" {
+		t.Fatalf("expected an env value outside Allowed to fail, got %q and %v", paint.Color, bindErr)
+	}
+
+	var res types.CmdResponse
+
+	if err := res.Bind(greetOptions{}); !errors.Is(err, types.ErrInvalidBindDest) {
+		t.Fatalf("expected a non-pointer to be rejected, got %v", err)
+	}
+
+	if err := res.Bind(&struct {
+		Count uint `kommando:"count"`
+	}{}); !errors.Is(err, types.ErrUnsupportedField) {
+		t.Fatalf("expected an unsupported field type to be rejected, got %v", err)
+	}
+
+	if err := res.Bind(&struct {
+		Count int `kommando:"count,default=many"`
+	}{}); !errors.Is(err, types.ErrInvalidBindTag) {
+		t.Fatalf("expected a mismatched default to be rejected, got %v", err)
+	}
+
+	if err := res.Bind(&struct {
+		Count int `kommando:"count,required"`
+	}{}); !errors.Is(err, types.ErrRequiredFlag) {
+		t.Fatalf("expected a missing required field to fail, got %v", err)
+	}
+}
+
+func TestKommandoHidden(t *testing.T) {
+	app := types.Config{
+		AppName:              "Kommando Hidden App",
+		CommandsCommand:      true,
+		CommandAbbreviations: true,
+	}
+
+	var debugged bool
+	var received map[string]interface{}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "debug-dump",
+			Description: "Dumps internal state.",
+			Hidden:      true,
+			Execute: func(res *types.CmdResponse) {
+				debugged = true
+			},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "build",
+			Description: "Builds the project.",
+			Flags: []types.Flag{
+				{Name: "release", ValueType: "bool"},
+				{Name: "experimental-cache", ValueType: "int", Hidden: true},
+			},
+			Execute: func(res *types.CmdResponse) {
+				received = res.Args
+			},
+		},
+	)
+
+	if res := kommandotest.RunCommand(t, &app, "debug-dump"); res.Err != nil || !debugged {
+		t.Fatalf("expected the hidden command to run, got %v", res.Err)
+	}
+
+	kommandotest.RunCommand(t, &app, "build", "--experimental-cache", "3")
+
+	if received["experimental-cache"] != "3" {
+		t.Fatalf("expected the hidden flag to parse, got %v", received)
+	}
+
+	res := kommandotest.RunCommand(t, &app, "build", "--experimental-cache", "lots")
+	kommandotest.RequireError(t, res, types.ErrInvalidFlagValue)
+
+	for _, args := range [][]string{{}, {"commands"}, {"commands", "--format", "json"}, {"help", "build"}, {"debug-dum"}} {
+		res := kommandotest.RunCommand(t, &app, args...)
+
+		if strings.Contains(res.Stdout, "debug-dump") || strings.Contains(res.Stdout, "experimental") {
+			t.Fatalf("%v: expected hidden commands and flags to be left out, got %q", args, res.Stdout)
+		}
+	}
+
+	res = kommandotest.RunCommand(t, &app, "commands", "--all", "--format", "json")
+
+	var listing []struct {
+		Name     string `json:"name"`
+		Runnable bool   `json:"runnable"`
+	}
+
+	if err := json.Unmarshal([]byte(res.Stdout), &listing); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", res.Stdout, err)
+	}
+
+	if listing[0].Name != "debug-dump" || !listing[0].Runnable || !strings.Contains(res.Stdout, "experimental-cache") {
+		t.Fatalf("expected --all to list hidden commands and flags, got %q", res.Stdout)
+	}
+
+	debugged = false
+	kommandotest.RunCommand(t, &app, "debug")
+
+	if debugged {
+		t.Fatalf("expected hidden commands not to resolve by abbreviation")
+	}
+}
+
+func TestKommandoExitCode(t *testing.T) {
+	errFailed := errors.New("deploy failed")
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errFailed, 1},
+		{fmt.Errorf("%w: --name", types.ErrRequiredFlag), 2},
+		{&types.ExitError{Code: 3, Err: errFailed}, 3},
+		{fmt.Errorf("wrapped: %w", &types.ExitError{Code: 4}), 4},
+	}
+
+	for _, tt := range tests {
+		if got := types.ExitCode(tt.err); got != tt.want {
+			t.Fatalf("%v: expected exit code %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestKommandoRunAndExit(t *testing.T) {
+	if args := os.Getenv("KOMMANDO_RUN_AND_EXIT"); args != "" {
+		app := types.Config{
+			AppName:     "exitapp",
+			UserAliases: map[string][]string{"ship": {"deploy"}},
+		}
+
+		app.AddCommand(
+			&types.Command{
+				Name:        "deploy",
+				Description: "Deploys an environment.",
+				ArgsMin:     1,
+				ArgsMax:     1,
+				Before: func(res *types.CmdResponse) error {
+					if res.Args["args"].([]string)[0] == "prod" {
+						return &types.ExitError{Code: 3, Err: errors.New("prod is frozen")}
+					}
+
+					return nil
+				},
+				Execute: func(res *types.CmdResponse) {},
+			},
+		)
+
+		app.SetOutput(io.Discard)
+		app.RunAndExit(strings.Fields(args))
+
+		return
+	}
+
+	tests := []struct {
+		args   string
+		code   int
+		stderr string
+	}{
+		{"deploy staging", 0, ""},
+		{"deploy", 2, "exitapp: invalid arguments: deploy: expected exactly 1 argument, got 0\nUsage: exitapp deploy <arg>\n"},
+		{"deploy prod", 3, "exitapp: prod is frozen\n"},
+		{"ship", 2, "exitapp: invalid arguments: deploy: expected exactly 1 argument, got 0\nUsage: exitapp deploy <arg>\n"},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestKommandoRunAndExit$")
+		cmd.Env = append(os.Environ(), "KOMMANDO_RUN_AND_EXIT="+tt.args)
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+
+		code := 0
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.args, err)
+		}
+
+		if code != tt.code || stderr.String() != tt.stderr {
+			t.Fatalf("%s: expected exit code %d and %q, got %d and %q", tt.args, tt.code, tt.stderr, code, stderr.String())
+		}
+	}
+}
+
+func TestKommandoVersionAndHelpFlags(t *testing.T) {
+	app := types.Config{
+		AppName: "kapp",
+		Version: "1.2.3",
+	}
+
+	var executed bool
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{Required: &[]bool{true}[0], Name: "env", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				executed = true
+			},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "grep",
+			Description: "Searches files.",
+			Flags: []types.Flag{
+				{Name: "h", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				executed = true
+			},
+		},
+	)
+
+	for _, args := range [][]string{{"version"}, {"--version"}, {"-V"}} {
+		res := kommandotest.RunCommand(t, &app, args...)
+
+		if res.Err != nil || res.Stdout != "kapp version 1.2.3\n" {
+			t.Fatalf("%v: expected the version, got %q and %v", args, res.Stdout, res.Err)
+		}
+	}
+
+	for _, args := range [][]string{{"deploy", "--help"}, {"deploy", "-h"}, {"grep", "-h", "--help"}} {
+		executed = false
+		res := kommandotest.RunCommand(t, &app, args...)
+
+		if res.Err != nil || executed || !strings.HasPrefix(res.Stdout, args[0]+" | Info\n") {
+			t.Fatalf("%v: expected help instead of running, got %q and %v", args, res.Stdout, res.Err)
+		}
+	}
+
+	executed = false
+	res := kommandotest.RunCommand(t, &app, "grep", "-h")
+
+	if res.Err != nil || !executed {
+		t.Fatalf("expected a declared -h flag to win, got %v", res.Err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "deploy", "--env", "prod", "--", "--help")
+
+	if res.Err != nil || !executed {
+		t.Fatalf("expected --help after -- to be an argument, got %v", res.Err)
+	}
+
+	var message string
+
+	app.AddCommand(
+		&types.Command{
+			Name: "say",
+			Flags: []types.Flag{
+				{Name: "message", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				message = res.Args["message"].(string)
+			},
+		},
+	)
+
+	res = kommandotest.RunCommand(t, &app, "say", "--message", "-h")
+
+	if res.Err != nil || message != "-h" {
+		t.Fatalf("expected -h to be the value of --message, got %q and %v", message, res.Err)
+	}
+
+	message = ""
+	res = kommandotest.RunCommand(t, &app, "say", "--message", "-h", "--help")
+
+	if res.Err != nil || message != "" || !strings.HasPrefix(res.Stdout, "say | Info\n") {
+		t.Fatalf("expected help after the value of --message, got %q and %v", res.Stdout, res.Err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "deploy")
+
+	if !strings.Contains(res.Stdout, "Flags |> --env, --help\n") {
+		t.Fatalf("expected --help to be listed, got %q", res.Stdout)
+	}
+
+	err := app.AddCommandE(&types.Command{
+		Name:    "lookup",
+		Flags:   []types.Flag{{Name: "help", ValueType: "bool"}},
+		Execute: func(res *types.CmdResponse) {},
+	})
+
+	if !errors.Is(err, types.ErrDuplicateFlag) {
+		t.Fatalf("expected a declared help flag to be rejected, got %v", err)
+	}
+
+	common := types.NewFlagSet("common")
+
+	app.AddFlagSet(common)
+	app.AddCommand(
+		&types.Command{
+			Name:     "lookup",
+			FlagSets: []string{"common"},
+			Execute:  func(res *types.CmdResponse) {},
+		},
+	)
+	common.Flags = append(common.Flags, types.Flag{Name: "help", ValueType: "bool"})
+
+	if err := app.Validate(); !errors.Is(err, types.ErrDuplicateFlag) {
+		t.Fatalf("expected Validate to reject a help flag from a flag set, got %v", err)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "lookup")
+
+	if !strings.Contains(res.Stdout, "Flags |> --help\n") {
+		t.Fatalf("expected --help to be listed once, got %q", res.Stdout)
+	}
+
+	app = types.Config{
+		AppName: "kapp",
+	}
+
+	if res := kommandotest.RunCommand(t, &app, "--version"); strings.Contains(res.Stdout, "version") {
+		t.Fatalf("expected no version command without a version, got %q", res.Stdout)
+	}
+}
+
+func TestKommandoResponseValues(t *testing.T) {
+	var leaked bool
+
+	app := types.Config{
+		AppName: "Kommando Values App",
+		Before: func(res *types.CmdResponse) error {
+			if _, ok := res.Get("client"); ok {
+				leaked = true
+			}
+
+			res.Set("client", "client-for-"+res.Args["env"].(string))
+
+			return res.SetFlag("env", " PROD ")
+		},
+	}
+
+	var client interface{}
+	var env interface{}
+	var errs []error
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Flags: []types.Flag{
+				{Name: "env", ValueType: "string", Normalize: strings.TrimSpace},
+				{Name: "replicas", ValueType: "int"},
+			},
+			Execute: func(res *types.CmdResponse) {
+				client, _ = res.Get("client")
+				env = res.Args["env"]
+				errs = []error{res.SetFlag("replicas", "many"), res.SetFlag("missing", "x")}
+			},
+		},
+	)
+
+	kommandotest.RunCommand(t, &app, "deploy", "--env", "staging")
+
+	if client != "client-for-staging" || env != "PROD" {
+		t.Fatalf("expected values from the Before hook, got %v and %v", client, env)
+	}
+
+	if !errors.Is(errs[0], types.ErrInvalidFlagValue) || !errors.Is(errs[1], types.ErrUnknownFlag) {
+		t.Fatalf("expected SetFlag to validate, got %v", errs)
+	}
+
+	kommandotest.RunCommand(t, &app, "deploy", "--env", "staging")
+
+	if leaked {
+		t.Fatalf("expected values not to leak between runs")
+	}
+}
+
+func TestKommandoBindSliceSplitting(t *testing.T) {
+	type requestOptions struct {
+		Tags    []string `kommando:"tags,env=KOMMANDO_TEST_TAGS"`
+		Headers []string `kommando:"headers,nosplit,env=KOMMANDO_TEST_HEADERS"`
+	}
+
+	t.Setenv("KOMMANDO_TEST_TAGS", `a\,b,c`)
+	t.Setenv("KOMMANDO_TEST_HEADERS", "Accept: a,b")
+
+	var opts requestOptions
+
+	res := types.CmdResponse{Args: map[string]interface{}{}}
+
+	if err := res.Bind(&opts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := requestOptions{Tags: []string{"a,b", "c"}, Headers: []string{"Accept: a,b"}}
+
+	if !reflect.DeepEqual(opts, want) {
+		t.Fatalf("expected %q, got %q", want, opts)
+	}
+
+	res.Args["tags"] = "x,y"
+	res.Args["headers"] = `x\,y,z`
+
+	if err := res.Bind(&opts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want = requestOptions{Tags: []string{"x", "y"}, Headers: []string{`x\,y,z`}}
+
+	if !reflect.DeepEqual(opts, want) {
+		t.Fatalf("expected %q, got %q", want, opts)
+	}
+}
+
+func TestKommandoStrictBoolFlags(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Strict Bools App",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "rm",
+			Description: "Removes files.",
+			Flags: []types.Flag{
+				{Name: "force", ValueType: "bool"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+
+	// Any token strconv.ParseBool accepts is at risk: 1, 0, t, f, T, F,
+	// true, false, TRUE, FALSE, True and False.
+	tests := []struct {
+		strict bool
+		args   []string
+		want   map[string]interface{}
+	}{
+		{false, []string{"rm", "--force", "1", "file.txt"}, map[string]interface{}{"force": "1", "args": []string{"file.txt"}}},
+		{true, []string{"rm", "--force", "1", "file.txt"}, map[string]interface{}{"force": "true", "args": []string{"1", "file.txt"}}},
+		{true, []string{"rm", "--force=false", "f"}, map[string]interface{}{"force": "false", "args": []string{"f"}}},
+	}
+
+	for _, tt := range tests {
+		app.StrictBoolFlags = tt.strict
+
+		res, err := app.ParseE(tt.args)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", tt.args, err)
+		}
+
+		if !reflect.DeepEqual(res.Args, tt.want) {
+			t.Fatalf("strict=%t %v: expected %v, got %v", tt.strict, tt.args, tt.want, res.Args)
+		}
+	}
+}
+
+func TestKommandoHelpTemplates(t *testing.T) {
+	app := types.Config{
+		AppName: "Kommando Templates App",
+		Version: "2.0.0",
+	}
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "deploy",
+			Description: "Deploys the app.",
+			Aliases:     []string{"d"},
+			Flags: []types.Flag{
+				{Name: "env", Description: "Target environment.", ValueType: "string"},
+			},
+			Execute: func(res *types.CmdResponse) {},
+		},
+	)
+	app.AddCommand(
+		&types.Command{
+			Name:        "internal",
+			Description: "Internal command.",
+			Hidden:      true,
+			Execute:     func(res *types.CmdResponse) {},
+		},
+	)
+
+	defaultHelp := kommandotest.RunCommand(t, &app, "help", "deploy").Stdout
+
+	deploy := app.Parse([]string{"deploy"}).Command
+
+	if got := app.HelpFor(&deploy); got != defaultHelp {
+		t.Fatalf("expected HelpFor to match 'help deploy', got %q and %q", got, defaultHelp)
+	}
+
+	defaultList := kommandotest.RunCommand(t, &app).Stdout
+
+	app.HelpTemplate = types.DefaultHelpTemplate
+	app.CommandHelpTemplate = types.DefaultCommandHelpTemplate
+
+	if got := kommandotest.RunCommand(t, &app).Stdout; got != defaultList {
+		t.Fatalf("expected DefaultHelpTemplate to match the command list, got %q and %q", got, defaultList)
+	}
+
+	if got := app.HelpFor(&deploy); got != defaultHelp {
+		t.Fatalf("expected DefaultCommandHelpTemplate to match 'help deploy', got %q and %q", got, defaultHelp)
+	}
+
+	app.HelpTemplate = "{{.AppName}} v{{.Version}}\n{{range .Commands}}{{if not .Hidden}}* {{.Name}}\n{{end}}{{end}}"
+	app.CommandHelpTemplate = "{{.Command.Name}} ({{join .Command.Aliases \", \"}}): {{.Command.Description}}\n{{range .Command.Flags}}  --{{.Name}}  {{.Description}}\n{{end}}"
+
+	if err := app.Validate(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res := kommandotest.RunCommand(t, &app)
+
+	if want := "Kommando Templates App v2.0.0\n* deploy\n* help\n* version\n"; res.Stdout != want {
+		t.Fatalf("expected %q, got %q", want, res.Stdout)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "help", "deploy")
+
+	if want := "deploy (d): Deploys the app.\n  --env  Target environment.\n"; res.Stdout != want || app.HelpFor(&deploy) != want {
+		t.Fatalf("expected %q, got %q", want, res.Stdout)
+	}
+
+	app.CommandHelpTemplate = "{{.Command.Name"
+
+	if err := app.Validate(); !errors.Is(err, types.ErrInvalidTemplate) {
+		t.Fatalf("expected an invalid template to be reported, got %v", err)
+	}
+}
+
+func TestKommandoConcurrentParse(t *testing.T) {
+	app := types.Config{
+		AppName:         "Kommando Concurrent App",
+		CommandsCommand: true,
+		Version:         "1.0.0",
+	}
+
+	app.AddFlagSet(types.NewFlagSet("common",
+		types.Flag{Name: "verbose", ValueType: "bool"},
+	))
+
+	app.AddCommand(
+		&types.Command{
+			Name:        "get",
+			Description: "Gets a resource.",
+			Flags: []types.Flag{
+				{Name: "output", ValueType: "string"},
+			},
+			FlagSets: []string{"common"},
+			Aliases:  []string{"g"},
+			Execute:  func(res *types.CmdResponse) {},
+		},
+	)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for _, args := range [][]string{{"g", "--output", "json", "--verbose"}, {"commands", "--format", "json"}, {"help", "get"}, {"version"}} {
+				res, err := app.ParseE(args)
+				if err != nil || res == nil {
+					t.Errorf("%v: unexpected result %v and %v", args, res, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestKommandoBuiltinNameClash(t *testing.T) {
+	app := types.Config{
+		AppName:         "Kommando Clash App",
+		CommandsCommand: true,
+		Version:         "1.0.0",
+	}
+
+	var ran []string
+
+	for _, name := range []string{"version", "help"} {
+		name := name
+
+		app.AddCommand(
+			&types.Command{
+				Name:        name,
+				Description: "Custom " + name + ".",
+				Execute: func(res *types.CmdResponse) {
+					ran = append(ran, name)
+				},
+			},
+		)
+	}
+
+	res := kommandotest.RunCommand(t, &app)
+
+	for _, name := range []string{"version", "help"} {
+		if strings.Count(res.Stdout, "\n"+name+" |> ") != 1 {
+			t.Fatalf("expected %s to be listed once, got %q", name, res.Stdout)
+		}
+	}
+
+	kommandotest.RunCommand(t, &app, "version")
+	kommandotest.RunCommand(t, &app, "help")
+
+	if !reflect.DeepEqual(ran, []string{"version", "help"}) {
+		t.Fatalf("expected the registered commands to run, got %v", ran)
+	}
+
+	res = kommandotest.RunCommand(t, &app, "commands", "--format", "json")
+
+	if strings.Count(res.Stdout, `"name": "version"`) != 1 {
+		t.Fatalf("expected version to be listed once, got %q", res.Stdout)
+	}
+}
@@ -0,0 +1,86 @@
+// Package kommandotest provides helpers for testing kommando applications
+// without touching os.Args or os.Stdout.
+package kommandotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yigit433/kommando/types"
+)
+
+// Result holds what a single RunCommand call produced.
+type Result struct {
+	// Stdout and Stderr hold what the app printed to Output and
+	// ErrorOutput.
+	Stdout string
+	Stderr string
+	// Err is the error returned by Config.RunE.
+	Err error
+	// Panic is the value the run panicked with, or nil when it completed.
+	Panic interface{}
+}
+
+// RunCommand runs app with the given arguments, capturing everything it
+// prints. The app's writers and arguments are restored exactly as they
+// were afterwards, so the app can be reused between calls.
+func RunCommand(t testing.TB, app *types.Config, args ...string) Result {
+	t.Helper()
+
+	var (
+		out    bytes.Buffer
+		errOut bytes.Buffer
+		result Result
+	)
+
+	restore := app.Redirect(&out, &errOut, append([]string{}, args...))
+	defer restore()
+
+	func() {
+		defer func() {
+			result.Panic = recover()
+		}()
+
+		result.Err = app.RunE()
+	}()
+
+	result.Stdout = out.String()
+	result.Stderr = errOut.String()
+
+	return result
+}
+
+// RequireError fails the test unless the result's error matches target
+// according to errors.Is.
+func RequireError(t testing.TB, res Result, target error) {
+	t.Helper()
+
+	if !errors.Is(res.Err, target) {
+		t.Fatalf("expected an error matching %q, got %v", target, res.Err)
+	}
+}
+
+// RequirePanic fails the test unless the result holds a panic whose
+// message contains substr.
+func RequirePanic(t testing.TB, res Result, substr string) {
+	t.Helper()
+
+	if res.Panic == nil {
+		t.Fatalf("expected a panic containing %q, but the run completed", substr)
+	}
+
+	if msg := panicMessage(res.Panic); !strings.Contains(msg, substr) {
+		t.Fatalf("expected a panic containing %q, got %q", substr, msg)
+	}
+}
+
+func panicMessage(v interface{}) string {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+
+	return fmt.Sprint(v)
+}
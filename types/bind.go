@@ -0,0 +1,340 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// bindField is a struct field tagged for binding, e.g.
+// `kommando:"name,required,default=World,env=NAME,desc=who to greet"`.
+// The name defaults to the lowercased field name and desc, which may
+// contain commas, must come last. nosplit keeps []string values whole.
+type bindField struct {
+	index        int
+	name         string
+	required     bool
+	defaultValue string
+	hasDefault   bool
+	env          string
+	description  string
+	noSplit      bool
+}
+
+func bindFields(t reflect.Type) ([]bindField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, ErrInvalidBindDest
+	}
+
+	var fields []bindField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag, ok := sf.Tag.Lookup("kommando")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			return nil, fmt.Errorf("%w: field %s is unexported", ErrInvalidBindTag, sf.Name)
+		}
+
+		if _, ok := flagValueType(sf.Type); !ok {
+			return nil, fmt.Errorf("%w: field %s has type %s", ErrUnsupportedField, sf.Name, sf.Type)
+		}
+
+		field := bindField{index: i}
+
+		name, rest, _ := strings.Cut(tag, ",")
+		field.name = name
+
+		if field.name == "" {
+			field.name = strings.ToLower(sf.Name)
+		}
+
+		for rest != "" {
+			var option string
+
+			if strings.HasPrefix(rest, "desc=") {
+				option, rest = rest, ""
+			} else {
+				option, rest, _ = strings.Cut(rest, ",")
+			}
+
+			key, value, _ := strings.Cut(option, "=")
+
+			switch key {
+			case "required":
+				field.required = true
+			case "default":
+				field.defaultValue, field.hasDefault = value, true
+			case "env":
+				field.env = value
+			case "nosplit":
+				field.noSplit = true
+			case "desc":
+				field.description = value
+			default:
+				return nil, fmt.Errorf("%w: field %s: unknown option %q", ErrInvalidBindTag, sf.Name, key)
+			}
+		}
+
+		if field.hasDefault {
+			if err := setField(reflect.New(sf.Type).Elem(), field.defaultValue, field.noSplit); err != nil {
+				return nil, fmt.Errorf("%w: field %s: default: %v", ErrInvalidBindTag, sf.Name, err)
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// flagValueType returns the Flag.ValueType used to declare a field of type t.
+func flagValueType(t reflect.Type) (string, bool) {
+	if t == durationType {
+		return "string", true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", true
+	case reflect.Bool:
+		return "bool", true
+	case reflect.Int, reflect.Int64:
+		return "int", true
+	case reflect.Float64:
+		return "float", true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return "string", true
+		}
+	}
+
+	return "", false
+}
+
+// setField parses value into field. []string fields take comma separated
+// values, where "\," is a literal comma, unless noSplit is set; then the
+// value becomes a single element as is. time.Duration fields take values
+// like "1m30s".
+func setField(field reflect.Value, value string, noSplit bool) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	case reflect.Slice:
+		var values []string
+
+		switch {
+		case noSplit:
+			values = []string{value}
+		case value != "":
+			values = splitEscaped(value)
+		}
+
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedField, field.Type())
+	}
+
+	return nil
+}
+
+// splitEscaped splits value on commas that are not escaped as "\,".
+func splitEscaped(value string) []string {
+	var (
+		values  []string
+		current strings.Builder
+	)
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case value[i] == ',':
+			values = append(values, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+
+	return append(values, current.String())
+}
+
+// FlagsFromStruct declares a flag for every tagged field of the struct v
+// points to, so the struct passed to CmdResponse.Bind can also define the
+// command's Flags. Fields with a default or env option are never required
+// on the command line.
+func FlagsFromStruct(v interface{}) ([]Flag, error) {
+	t := reflect.TypeOf(v)
+
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil {
+		return nil, ErrInvalidBindDest
+	}
+
+	fields, err := bindFields(t)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make([]Flag, 0, len(fields))
+
+	for _, field := range fields {
+		valueType, _ := flagValueType(t.Field(field.index).Type)
+		required := field.required && !field.hasDefault && field.env == ""
+
+		flags = append(flags, Flag{
+			Required:    &required,
+			Name:        field.name,
+			Description: field.description,
+			ValueType:   valueType,
+		})
+	}
+
+	return flags, nil
+}
+
+// Bind fills the tagged fields of the struct dest points to from the parsed
+// flags, falling back to the field's env variable and then its default.
+// Env values go through the same checks as values from the command line.
+// A required field with none of these fails with ErrRequiredFlag.
+func (r *CmdResponse) Bind(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrInvalidBindDest
+	}
+
+	v = v.Elem()
+
+	fields, err := bindFields(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		target := v.Field(field.index)
+
+		if value, ok := r.Args[field.name]; ok {
+			if err := bindValue(target, field, value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if field.env != "" {
+			if value, ok := os.LookupEnv(field.env); ok {
+				if err := r.bindEnv(target, field, value); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		if field.hasDefault {
+			if err := setField(target, field.defaultValue, field.noSplit); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if field.required {
+			return fmt.Errorf("%w: --%s", ErrRequiredFlag, field.name)
+		}
+	}
+
+	return nil
+}
+
+// bindValue assigns a parsed flag value to target.
+func bindValue(target reflect.Value, field bindField, value interface{}) error {
+	if s, ok := value.(string); ok {
+		if err := setField(target, s, field.noSplit); err != nil {
+			return fmt.Errorf("%w: flag --%s: %v", ErrInvalidFlagValue, field.name, err)
+		}
+
+		return nil
+	}
+
+	if rv := reflect.ValueOf(value); rv.Type().AssignableTo(target.Type()) {
+		target.Set(rv)
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: flag --%s holds %T, not %s", ErrUnsupportedField, field.name, value, target.Type())
+}
+
+// bindEnv assigns the value of field's env variable to target. When the
+// command declares the flag, the value is normalized and checked against
+// the flag's type, Pattern and Allowed values first, as if it had been
+// given on the command line.
+func (r *CmdResponse) bindEnv(target reflect.Value, field bindField, value string) error {
+	if _, ok := r.Command.findFlag(field.name); !ok {
+		if err := setField(target, value, field.noSplit); err != nil {
+			return fmt.Errorf("%w: env %s: %v", ErrInvalidFlagValue, field.env, err)
+		}
+
+		return nil
+	}
+
+	values := make(map[string]interface{}, 1)
+
+	if err := r.Command.setFlag(values, field.name, value); err != nil {
+		return fmt.Errorf("env %s: %w", field.env, err)
+	}
+
+	if err := bindValue(target, field, values[field.name]); err != nil {
+		return fmt.Errorf("env %s: %w", field.env, err)
+	}
+
+	return nil
+}
@@ -1,14 +1,72 @@
 package types
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type CmdResponse struct {
 	Command Command
 	Args    map[string]interface{}
+	// RawArgs holds every argument Run received, and RawCommandArgs the
+	// ones after the command name, both before parsing. They are copies,
+	// so changing them does not affect the parser.
+	RawArgs        []string
+	RawCommandArgs []string
+	// UnknownFlags maps flags the command does not declare to the value
+	// they were given, "" when they took none. UnknownArgs keeps their raw
+	// tokens, values included, in command line order for passing them on.
+	UnknownFlags map[string]string
+	UnknownArgs  []string
+	ctx          context.Context
+	values       map[string]interface{}
+}
+
+// Context returns the context the run was started with, which is
+// context.Background() unless Config.RunContext was given another one.
+func (r *CmdResponse) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
+}
+
+// Set stores value under key for the rest of this run, so Before hooks can
+// hand derived values such as a client to Execute and After.
+func (r *CmdResponse) Set(key string, value interface{}) {
+	if r.values == nil {
+		r.values = make(map[string]interface{})
+	}
+
+	r.values[key] = value
+}
+
+// Get returns the value Set stored under key.
+func (r *CmdResponse) Get(key string) (interface{}, bool) {
+	value, ok := r.values[key]
+
+	return value, ok
+}
+
+// SetFlag overrides the value of a declared flag in Args, normalizing and
+// validating it exactly as the parser does.
+func (r *CmdResponse) SetFlag(name string, value string) error {
+	if _, ok := r.Command.findFlag(name); !ok {
+		return fmt.Errorf("%w: --%s", ErrUnknownFlag, name)
+	}
+
+	if r.Args == nil {
+		r.Args = make(map[string]interface{})
+	}
+
+	return r.Command.setFlag(r.Args, name, value)
 }
 
 type Flag struct {
@@ -16,129 +74,568 @@ type Flag struct {
 	Name        string
 	Description string
 	ValueType   string
+	// Pattern is an optional regular expression that values must match.
+	// PatternDescription, when set, replaces the pattern in error messages.
+	Pattern            string
+	PatternDescription string
+	// Normalize, when set, rewrites values before they are validated and
+	// stored, e.g. to lowercase or trim them.
+	Normalize func(string) string
+	// Allowed, when set, lists the only values the flag accepts; help shows
+	// them as the flag's choices. With AllowedIgnoreCase, values match
+	// regardless of case and are stored with the spelling from Allowed.
+	Allowed           []string
+	AllowedIgnoreCase bool
+	// Hidden flags parse and validate as usual but are left out of help and
+	// the commands listing.
+	Hidden bool
+}
+
+var patternCache sync.Map
+
+// negativeNumber matches tokens such as -5 or -2.5 that are read as
+// arguments rather than flags unless a flag with that name exists.
+var negativeNumber = regexp.MustCompile(`^-[0-9]+(\.[0-9]+)?$`)
+
+// compilePattern compiles a flag pattern once and caches the result.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Store(pattern, re)
+
+	return re, nil
+}
+
+// FlagSet is a named group of flags shared by several commands. Commands
+// reference it by name through Command.FlagSets, and changes to its Flags
+// reach them the next time they are parsed or shown in help.
+type FlagSet struct {
+	Name  string
+	Flags []Flag
+}
+
+func NewFlagSet(name string, flags ...Flag) *FlagSet {
+	return &FlagSet{
+		Name:  name,
+		Flags: flags,
+	}
 }
 
 type Command struct {
 	Name        string
 	Description string
-	Flags       []Flag
-	Aliases     []string
-	Execute     func(res *CmdResponse)
+	// Usage replaces the usage line help derives from the flags and the
+	// argument bounds, e.g. "deploy [flags] <env>". Example is shown at the
+	// bottom of the help, one example per line.
+	Usage    string
+	Example  string
+	Flags    []Flag
+	FlagSets []string
+	Aliases  []string
+	// HiddenAliases resolve like Aliases but are left out of help, which
+	// suits old names kept for backward compatibility.
+	HiddenAliases []string
+	// SuggestFor lists mistaken names, e.g. "remove" for a "delete"
+	// command, for which this command is suggested when they are typed.
+	SuggestFor []string
+	// Annotations holds arbitrary metadata for tooling built on top of the
+	// command, such as middleware or docs generators.
+	Annotations map[string]string
+	// DisableFlagParsing passes every argument after the command name to
+	// Execute untouched under Args["args"], including ones that look like
+	// flags and "--".
+	DisableFlagParsing bool
+	// ArgsMin and ArgsMax bound the number of positional arguments; zero
+	// means no bound. ArgsValidator, when set, replaces both checks.
+	ArgsMin       int
+	ArgsMax       int
+	ArgsValidator func(args []string) error
+	// Before runs ahead of Execute and aborts the run when it fails. After
+	// runs once Execute is done, even if it panicked; see Config.Before.
+	Before  func(res *CmdResponse) error
+	After   func(res *CmdResponse) error
+	Execute func(res *CmdResponse)
+	// Hidden commands run when named exactly but are left out of the command
+	// list, the commands listing, suggestions and abbreviations.
+	Hidden bool
+	// flagIndex maps flag names to their position in Flags. Config builds
+	// it when registering the command; other copies build it on first
+	// lookup.
+	flagIndex map[string]int
+	// builtin marks commands the framework adds itself.
+	builtin bool
+}
+
+// Clone returns a deep copy of the command, so that changing the clone's
+// Flags, FlagSets, Aliases or Annotations never affects the original, and
+// then applies overrides to it.
+func (c *Command) Clone(overrides ...func(*Command)) *Command {
+	clone := *c
+	clone.flagIndex = nil
+
+	if c.Flags != nil {
+		clone.Flags = make([]Flag, len(c.Flags))
+
+		for i, flag := range c.Flags {
+			if flag.Required != nil {
+				required := *flag.Required
+				flag.Required = &required
+			}
+
+			if flag.Allowed != nil {
+				flag.Allowed = append([]string(nil), flag.Allowed...)
+			}
+
+			clone.Flags[i] = flag
+		}
+	}
+
+	if c.FlagSets != nil {
+		clone.FlagSets = append([]string(nil), c.FlagSets...)
+	}
+
+	if c.Aliases != nil {
+		clone.Aliases = append([]string(nil), c.Aliases...)
+	}
+
+	if c.HiddenAliases != nil {
+		clone.HiddenAliases = append([]string(nil), c.HiddenAliases...)
+	}
+
+	if c.SuggestFor != nil {
+		clone.SuggestFor = append([]string(nil), c.SuggestFor...)
+	}
+
+	if c.Annotations != nil {
+		clone.Annotations = make(map[string]string, len(c.Annotations))
+
+		for key, value := range c.Annotations {
+			clone.Annotations[key] = value
+		}
+	}
+
+	for _, override := range overrides {
+		override(&clone)
+	}
+
+	return &clone
+}
+
+// checkArgsBounds reports an ArgsMax below ArgsMin, which no number of
+// arguments could satisfy. An ArgsMax of zero means no upper bound.
+func (c *Command) checkArgsBounds() error {
+	if c.ArgsMax != 0 && c.ArgsMin > c.ArgsMax {
+		return &InvalidArgsError{
+			Command: c.Name,
+			Min:     c.ArgsMin,
+			Max:     c.ArgsMax,
+			Err:     fmt.Errorf("ArgsMin %d is greater than ArgsMax %d", c.ArgsMin, c.ArgsMax),
+		}
+	}
+
+	return nil
+}
+
+// validateArgs checks the positional arguments against ArgsValidator, or
+// ArgsMin and ArgsMax when no validator is set.
+func (c *Command) validateArgs(args []string) error {
+	if c.ArgsValidator != nil {
+		if err := c.ArgsValidator(args); err != nil {
+			return &InvalidArgsError{Command: c.Name, Got: len(args), Min: c.ArgsMin, Max: c.ArgsMax, Err: err}
+		}
+
+		return nil
+	}
+
+	got := len(args)
+
+	if (c.ArgsMin == 0 || got >= c.ArgsMin) && (c.ArgsMax == 0 || got <= c.ArgsMax) {
+		return nil
+	}
+
+	var (
+		expected string
+		bound    int
+	)
+
+	switch {
+	case c.ArgsMin == c.ArgsMax:
+		expected, bound = fmt.Sprintf("exactly %d", c.ArgsMin), c.ArgsMin
+	case c.ArgsMax == 0:
+		expected, bound = fmt.Sprintf("at least %d", c.ArgsMin), c.ArgsMin
+	case c.ArgsMin == 0:
+		expected, bound = fmt.Sprintf("at most %d", c.ArgsMax), c.ArgsMax
+	default:
+		expected, bound = fmt.Sprintf("between %d and %d", c.ArgsMin, c.ArgsMax), c.ArgsMax
+	}
+
+	noun := "arguments"
+
+	if bound == 1 {
+		noun = "argument"
+	}
+
+	return &InvalidArgsError{
+		Command: c.Name,
+		Got:     got,
+		Min:     c.ArgsMin,
+		Max:     c.ArgsMax,
+		Err:     fmt.Errorf("expected %s %s, got %d", expected, noun, got),
+	}
 }
 
-func (c *Command) isValidAliase(aliase string) *bool {
+func (c *Command) findFlag(name string) (*Flag, bool) {
+	if c.flagIndex == nil {
+		c.flagIndex = indexFlags(c.Flags)
+	}
+
+	i, ok := c.flagIndex[name]
+	if !ok {
+		return nil, false
+	}
+
+	return &c.Flags[i], true
+}
+
+// indexFlags maps flag names to their position in flags, keeping the first
+// flag declared with a name.
+func indexFlags(flags []Flag) map[string]int {
+	index := make(map[string]int, len(flags))
+
+	for i, flag := range flags {
+		if _, ok := index[flag.Name]; !ok {
+			index[flag.Name] = i
+		}
+	}
+
+	return index
+}
+
+// isValidFlag validates fvalue against the flag named fname and returns the
+// value to store for it. It reports false for flags the command does not
+// declare.
+func (c *Command) isValidFlag(fname string, fvalue interface{}) (interface{}, bool, error) {
 	var output bool = false
 
-	for _, alias := range c.Aliases {
-		if alias == aliase {
+	stored := fvalue
+
+	if flag, ok := c.findFlag(fname); ok {
+		if flag.ValueType == "bool" {
+			_, err := strconv.ParseBool(fvalue.(string))
+			if err != nil {
+				return nil, false, invalidFlagValue(*flag, fvalue.(string), "true or false")
+			}
+
 			output = true
+		} else if flag.ValueType == "int" {
+			_, err := strconv.ParseInt(fvalue.(string), 10, 64)
+			if err != nil {
+				return nil, false, invalidFlagValue(*flag, fvalue.(string), "an integer like 42")
+			}
 
-			break
+			output = true
+		} else if flag.ValueType == "float" {
+			_, err := strconv.ParseFloat(fvalue.(string), 64)
+			if err != nil {
+				return nil, false, invalidFlagValue(*flag, fvalue.(string), "a number like 3.14")
+			}
+
+			output = true
+		} else if parse, ok := lookupFlagType(flag.ValueType); ok {
+			parsed, err := parse(fvalue.(string))
+			if err != nil {
+				return nil, false, fmt.Errorf("%w: %v", invalidFlagValue(*flag, fvalue.(string), "a valid "+flag.ValueType), err)
+			}
+
+			stored = parsed
+			output = true
+		} else if reflect.TypeOf(fvalue).Name() == "string" {
+			output = true
+		}
+
+		if output && flag.Pattern != "" {
+			if err := matchPattern(*flag, fvalue.(string)); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if output && len(flag.Allowed) > 0 {
+			allowed, err := matchAllowed(*flag, fvalue.(string))
+			if err != nil {
+				return nil, false, err
+			}
+
+			if _, ok := stored.(string); ok {
+				stored = allowed
+			}
 		}
 	}
 
-	return &output
+	return stored, output, nil
 }
 
-func (c *Command) isValidFlag(fname string, fvalue interface{}) *bool {
-	var output bool = false
+// matchAllowed returns the entry of flag.Allowed that value matches.
+func matchAllowed(flag Flag, value string) (string, error) {
+	for _, allowed := range flag.Allowed {
+		if allowed == value || (flag.AllowedIgnoreCase && strings.EqualFold(allowed, value)) {
+			return allowed, nil
+		}
+	}
 
-	for _, flag := range c.Flags {
-		if flag.Name == fname {
-			if flag.ValueType == "bool" {
-				_, err := strconv.ParseBool(fvalue.(string))
-				if err != nil {
-					panic(err)
-					break
-				}
+	return "", invalidFlagValue(flag, value, "one of "+strings.Join(flag.Allowed, ", "))
+}
 
-				output = true
-			} else if flag.ValueType == "int" {
-				_, err := strconv.ParseInt(fvalue.(string), 10, 64)
-				if err != nil {
-					panic(err)
-					break
-				}
+func matchPattern(flag Flag, value string) error {
+	re, err := compilePattern(flag.Pattern)
+	if err != nil {
+		return fmt.Errorf("%w: flag --%s: %v", ErrInvalidPattern, flag.Name, err)
+	}
 
-				output = true
-			} else if flag.ValueType == "float" {
-				_, err := strconv.ParseFloat(fvalue.(string), 64)
-				if err != nil {
-					panic(err)
-					break
-				}
+	if re.MatchString(value) {
+		return nil
+	}
+
+	if flag.PatternDescription != "" {
+		return fmt.Errorf("%w: flag --%s: %s, got %q", ErrInvalidFlagValue, flag.Name, flag.PatternDescription, value)
+	}
+
+	return fmt.Errorf("%w: flag --%s: expected a value matching %q, got %q", ErrInvalidFlagValue, flag.Name, flag.Pattern, value)
+}
+
+func invalidFlagValue(flag Flag, value string, expected string) error {
+	return fmt.Errorf("%w: flag --%s: expected %s, got %q", ErrInvalidFlagValue, flag.Name, expected, value)
+}
+
+// flagValue decides the value of a flag written without "=", given the
+// arguments that follow it, and reports whether the next argument was
+// consumed. Bool flags only take the next argument when it parses as a
+// bool, and never with strictBools; unknown flags take it unless it looks
+// like another flag.
+func (c *Command) flagValue(name string, rest []string, strictBools bool) (string, bool, error) {
+	flag, ok := c.findFlag(name)
+	if !ok {
+		if len(rest) > 0 && (!strings.HasPrefix(rest[0], "-") || rest[0] == "-") {
+			return rest[0], true, nil
+		}
 
-				output = true
-			} else if reflect.TypeOf(fvalue).Name() == "string" {
-				output = true
+		return "", false, nil
+	}
+
+	if flag.ValueType == "bool" {
+		if len(rest) > 0 && !strictBools {
+			if _, err := strconv.ParseBool(rest[0]); err == nil {
+				return rest[0], true, nil
 			}
 		}
+
+		return "true", false, nil
 	}
 
-	return &output
+	if len(rest) == 0 {
+		return "", false, fmt.Errorf("%w: --%s", ErrMissingFlagValue, name)
+	}
+
+	return rest[0], true, nil
 }
 
-func (c *Command) argParser(args []string) map[string]interface{} {
-	output := make(map[string]interface{})
+// isNegativeNumber reports whether arg is a negative number that does not
+// name one of the command's flags.
+func (c *Command) isNegativeNumber(arg string) bool {
+	if !negativeNumber.MatchString(arg) {
+		return false
+	}
 
-	output["args"] = []string{}
+	_, ok := c.findFlag(arg[1:])
 
-	for ind, arg := range args {
-		if strings.Contains(arg, "--") {
-			vals := strings.Split(arg, "--")
+	return !ok
+}
 
-			if strings.Contains(vals[1], "=") {
-				parsed := strings.Split(vals[1], "=")
+func (c *Command) setFlag(output map[string]interface{}, name string, value string) error {
+	if flag, ok := c.findFlag(name); ok && flag.Normalize != nil {
+		value = flag.Normalize(value)
+	}
 
-				if *c.isValidFlag(parsed[0], parsed[1]) {
-					output[parsed[0]] = parsed[1]
-				}
-			} else if *c.isValidFlag(vals[1], args[ind+1]) {
-				output[vals[1]] = args[ind+1]
+	stored, valid, err := c.isValidFlag(name, value)
+	if err != nil {
+		return err
+	}
+
+	if valid {
+		output[name] = stored
+	}
+
+	return nil
+}
+
+// shortFlagGroup splits a single-dash group such as -abc into the one-letter
+// flags it names. It only applies when no flag matches the whole group, every
+// letter is a declared flag and all but the last are bool flags, so the last
+// one may still take a value (-vf file.txt).
+func (c *Command) shortFlagGroup(arg string) ([]string, bool) {
+	if len([]rune(arg)) < 3 || strings.HasPrefix(arg, "--") {
+		return nil, false
+	}
+
+	if _, ok := c.findFlag(arg[1:]); ok {
+		return nil, false
+	}
+
+	letters := []rune(arg[1:])
+	shorts := make([]string, 0, len(letters))
+
+	for i, r := range letters {
+		flag, ok := c.findFlag(string(r))
+		if !ok {
+			return nil, false
+		}
+
+		if i < len(letters)-1 && flag.ValueType != "bool" {
+			return nil, false
+		}
+
+		shorts = append(shorts, flag.Name)
+	}
+
+	return shorts, true
+}
+
+// unknownFlags collects the flags argParser found that the command does not
+// declare, see CmdResponse.UnknownFlags.
+type unknownFlags struct {
+	values map[string]string
+	args   []string
+}
+
+func (u *unknownFlags) add(name string, value string, tokens ...string) {
+	if u.values == nil {
+		u.values = make(map[string]string)
+	}
+
+	u.values[name] = value
+	u.args = append(u.args, tokens...)
+}
+
+// errHelp is returned by argParser when the arguments ask for the
+// command's help: --help, or -h unless the command declares its own h
+// flag. Either is only recognized where a flag may appear, so a value such
+// as in --message -h is left alone, and it wins over errors in other flags.
+var errHelp = errors.New("help requested")
+
+func (c *Command) argParser(args []string, strictBools bool) (map[string]interface{}, unknownFlags, error) {
+	var (
+		unknown  unknownFlags
+		parseErr error
+	)
+
+	if c.DisableFlagParsing {
+		return map[string]interface{}{
+			"args": append([]string{}, args...),
+		}, unknown, nil
+	}
+
+	output := make(map[string]interface{}, len(c.Flags)+1)
+	positionals := make([]string, 0, len(args))
+
+	_, ownsH := c.findFlag("h")
+
+	fail := func(err error) {
+		if parseErr == nil {
+			parseErr = err
+		}
+	}
+
+	for ind := 0; ind < len(args); ind++ {
+		arg := args[ind]
+
+		if arg == "--" {
+			positionals = append(positionals, args[ind+1:]...)
+
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" || c.isNegativeNumber(arg) {
+			positionals = append(positionals, arg)
+
+			continue
+		}
+
+		if !c.builtin && (arg == "--help" || arg == "-h" && !ownsH) {
+			return nil, unknown, errHelp
+		}
+
+		name := strings.TrimPrefix(arg[1:], "-")
+
+		if fname, value, ok := strings.Cut(name, "="); ok {
+			if _, known := c.findFlag(fname); !known {
+				unknown.add(fname, value, arg)
+
+				continue
+			}
+
+			if err := c.setFlag(output, fname, value); err != nil {
+				fail(err)
 			}
-		} else if strings.Contains(arg, "-") {
-			vals := strings.Split(arg, "-")
 
-			if strings.Contains(vals[1], "=") {
-				parsed := strings.Split(vals[1], "=")
+			continue
+		}
 
-				if *c.isValidFlag(parsed[0], parsed[1]) {
-					output[parsed[0]] = parsed[1]
+		if shorts, ok := c.shortFlagGroup(arg); ok {
+			for _, short := range shorts[:len(shorts)-1] {
+				if err := c.setFlag(output, short, "true"); err != nil {
+					fail(err)
 				}
-			} else if *c.isValidFlag(vals[1], args[ind+1]) {
-				output[vals[1]] = args[ind+1]
 			}
-		} else {
-			if (ind - 1) >= 0 {
-				cont1 := strings.Contains(args[ind-1], "--")
-				cont2 := strings.Contains(args[ind-1], "-")
 
-				if !cont1 || !cont2 || ((cont1 || cont2) && strings.Contains(args[ind-1], "=")) {
-					args := output["args"].([]string)
+			name = shorts[len(shorts)-1]
+		}
 
-					args = append(args, arg)
+		value, consumed, err := c.flagValue(name, args[ind+1:], strictBools)
+		if err != nil {
+			fail(err)
 
-					output["args"] = args
-				}
+			continue
+		}
+
+		if _, known := c.findFlag(name); !known {
+			if consumed {
+				unknown.add(name, value, arg, value)
+				ind++
 			} else {
-				args := output["args"].([]string)
+				unknown.add(name, value, arg)
+			}
 
-				args = append(args, arg)
+			continue
+		}
 
-				output["args"] = args
-			}
+		if consumed {
+			ind++
+		}
+
+		if err := c.setFlag(output, name, value); err != nil {
+			fail(err)
 		}
 	}
 
-	if len(output) >= 1 {
-		for _, flags := range c.Flags {
-			_, ok := output[flags.Name]
+	if parseErr != nil {
+		return nil, unknown, parseErr
+	}
 
-			if *flags.Required && !ok {
-				panic("Required flag not specified!")
-			}
+	output["args"] = positionals
+
+	for _, flag := range c.Flags {
+		_, ok := output[flag.Name]
+
+		if flag.Required != nil && *flag.Required && !ok {
+			return nil, unknown, fmt.Errorf("%w: --%s", ErrRequiredFlag, flag.Name)
 		}
 	}
 
-	return output
+	return output, unknown, nil
 }
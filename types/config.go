@@ -1,106 +1,902 @@
 package types
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
 )
 
 const (
+	// MAIN_TEMPLATE, CMD_LIST, CMD_HELP and CMD_EXAMPLES are the placeholder
+	// layouts DefaultHelpTemplate and DefaultCommandHelpTemplate replaced,
+	// kept for compatibility.
 	MAIN_TEMPLATE string = "Welcome to {AppName}! That's a command list. Type 'help <command name>' to get help with any command.\n{CmdList}"
 	CMD_LIST      string = "{CmdName} |> {CmdDescription}"
-	CMD_HELP      string = "{CmdName} | Info\nDescription |> {CmdDescription}\nFlags |> {CmdFlags}\nAliases |> {CmdAliases}"
+	CMD_HELP      string = "{CmdName} | Info\n{CmdUsage}\nDescription |> {CmdDescription}\nFlags |> {CmdFlags}\nAliases |> {CmdAliases}"
+	CMD_EXAMPLES  string = "Examples:\n{CmdExamples}"
+	USAGE_LINE    string = "Usage: {Usage}"
+	SUGGESTION    string = "Unknown command '{CmdName}'. Did you mean {Suggestions}?"
 )
 
 type Config struct {
-	AppName  string
+	AppName string
+	// Usage, when set, is shown as a "Usage:" line under the welcome line
+	// of the command list, e.g. "myapp <command> [args]".
+	Usage string
+	// SortFlags lists the flags in a command's help alphabetically instead
+	// of in declaration order. --help stays last either way.
+	SortFlags bool
+	// UserAliases maps alias names to the arguments they expand to, like
+	// git's aliases, e.g. "co": {"checkout"}.
+	UserAliases map[string][]string
+	// CommandAbbreviations lets a unique prefix of a command name stand in
+	// for the full name, e.g. "stat" for "status".
+	CommandAbbreviations bool
+	// Telemetry, when set, is notified before and after every command run,
+	// hooks included. Panics in its methods are recovered and ignored.
+	Telemetry Telemetry
+	// CommandsCommand adds a built-in "commands" command that lists every
+	// command as text or, with --format json, as JSON. Hidden commands and
+	// flags are only listed with --all.
+	CommandsCommand bool
+	// ResponseFiles expands "@path" arguments into the whitespace separated
+	// tokens of that file before anything else is parsed.
+	ResponseFiles bool
+	// CancelSignals lists signals, e.g. os.Interrupt, that cancel the
+	// context passed to Execute.
+	CancelSignals []os.Signal
+	// StrictBoolFlags stops bool flags from taking the next argument as their
+	// value when it parses as a bool, so "--force 1 file" keeps "1" as an
+	// argument. Values then need "=", as in --force=false.
+	StrictBoolFlags bool
+	// HelpTemplate and CommandHelpTemplate, when set, are text/template
+	// sources that replace DefaultHelpTemplate and DefaultCommandHelpTemplate
+	// for the command list and the command help. They are executed with a
+	// HelpData and printed as is.
+	HelpTemplate        string
+	CommandHelpTemplate string
+	// Version, when set, adds a built-in "version" command, also reachable
+	// as --version or -V in place of a command, that prints it.
+	Version string
+	// DisableSuggestions turns off "did you mean" hints based on how close
+	// an unknown name is to a command name or alias. SuggestFor still applies.
+	DisableSuggestions bool
+	// Before and After wrap every command run, outside the command's own
+	// hooks: Config.Before, Command.Before, Execute, Command.After and then
+	// Config.After. A failing Before skips everything after it except the
+	// After hooks whose Before already ran. Built-in commands skip hooks.
+	Before   func(res *CmdResponse) error
+	After    func(res *CmdResponse) error
 	commands []Command
+	flagSets map[string]*FlagSet
+	// commandIndex maps command names and aliases to their position in
+	// commands, nameIndex maps names only. AddCommandE updates both, keeping
+	// the first registered match, so parsing never writes to the Config.
+	commandIndex map[string]int
+	nameIndex    map[string]int
+	output       io.Writer
+	errOutput    io.Writer
+	args         []string
+}
+
+// SetArgs overrides the arguments Run parses, which otherwise come from
+// os.Args[1:]. Passing nil restores the default.
+func (c *Config) SetArgs(args []string) {
+	c.args = args
+}
+
+// SetOutput sets the writer that help and command lists are printed to.
+// It can be called at any time; later runs pick up the new writer.
+func (c *Config) SetOutput(w io.Writer) {
+	c.output = w
+}
+
+// Output returns the writer used for printing, defaulting to os.Stdout.
+func (c *Config) Output() io.Writer {
+	if c.output == nil {
+		return os.Stdout
+	}
+
+	return c.output
+}
+
+// SetErrorOutput sets the writer RunAndExit prints errors to.
+func (c *Config) SetErrorOutput(w io.Writer) {
+	c.errOutput = w
+}
+
+// ErrorOutput returns the writer used for errors, defaulting to os.Stderr.
+func (c *Config) ErrorOutput() io.Writer {
+	if c.errOutput == nil {
+		return os.Stderr
+	}
+
+	return c.errOutput
+}
+
+// Redirect points output, error output and arguments at stdout, stderr
+// and args for a run, and returns a function that restores all three
+// exactly as they were, unset defaults included. Test helpers such as
+// kommandotest use it so one Config can be reused between runs.
+func (c *Config) Redirect(stdout, stderr io.Writer, args []string) func() {
+	output, errOutput, previousArgs := c.output, c.errOutput, c.args
+
+	c.output, c.errOutput, c.args = stdout, stderr, args
+
+	return func() {
+		c.output, c.errOutput, c.args = output, errOutput, previousArgs
+	}
+}
+
+// AddFlagSet registers a flag set that commands added afterwards can
+// reference by name.
+func (c *Config) AddFlagSet(set *FlagSet) {
+	if _, ok := c.flagSets[set.Name]; ok {
+		panic("There is a flag set with the name you are trying to add.")
+	}
+
+	if c.flagSets == nil {
+		c.flagSets = make(map[string]*FlagSet)
+	}
+
+	c.flagSets[set.Name] = set
 }
 
 func (c *Config) AddCommand(cmd *Command) {
-	if len(c.commands) == 0 {
-		c.commands = append(c.commands, *cmd)
-	} else {
-		for i, command := range c.commands {
-			if command.Name == cmd.Name {
-				panic("There is a command with the name you are trying to add.")
-				break
-			} else if i == len(c.commands)-1 {
-				c.commands = append(c.commands, *cmd)
+	if err := c.AddCommandE(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// AddCommandE is like AddCommand but returns an error instead of panicking.
+func (c *Config) AddCommandE(cmd *Command) error {
+	if cmd.Execute == nil {
+		return fmt.Errorf("%w: %q could never be run", ErrMissingExecute, cmd.Name)
+	}
+
+	if err := cmd.checkArgsBounds(); err != nil {
+		return err
+	}
+
+	expanded, err := c.expandFlagSets(*cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range expanded.Flags {
+		if flag.Name == "help" {
+			return fmt.Errorf("%w: --help of %q is reserved", ErrDuplicateFlag, cmd.Name)
+		}
+
+		if flag.Pattern == "" {
+			continue
+		}
+
+		if _, err := compilePattern(flag.Pattern); err != nil {
+			return fmt.Errorf("%w: flag --%s of %q: %v", ErrInvalidPattern, flag.Name, cmd.Name, err)
+		}
+	}
+
+	for _, existing := range c.commands {
+		if existing.Name == cmd.Name {
+			return fmt.Errorf("%w: %q", ErrDuplicateCommand, cmd.Name)
+		}
+	}
+
+	c.register(*cmd)
+
+	return nil
+}
+
+// expandFlagSets returns cmd with the current flags of its flag sets
+// appended to its own. Commands keep referencing their sets by name, so
+// flags added to a set later reach every command using it.
+func (c *Config) expandFlagSets(cmd Command) (Command, error) {
+	if len(cmd.FlagSets) == 0 {
+		return cmd, nil
+	}
+
+	cmd.flagIndex = nil
+
+	flags := append([]Flag(nil), cmd.Flags...)
+
+	for _, name := range cmd.FlagSets {
+		set, ok := c.flagSets[name]
+		if !ok {
+			return cmd, fmt.Errorf("%w: %q", ErrUnknownFlagSet, name)
+		}
+
+		for _, flag := range set.Flags {
+			for _, existing := range flags {
+				if existing.Name == flag.Name {
+					return cmd, fmt.Errorf("%w: --%s from flag set %q", ErrDuplicateFlag, flag.Name, name)
+				}
+			}
+
+			flags = append(flags, flag)
+		}
+	}
+
+	cmd.Flags = flags
+
+	return cmd, nil
+}
+
+// Validate checks every registered command and user alias and returns a
+// *ValidationError listing all problems found, or nil if there are none.
+func (c *Config) Validate() error {
+	var problems []error
+
+	owners := make(map[string]string)
+
+	for _, cmd := range c.commands {
+		if cmd.Name == "" {
+			problems = append(problems, fmt.Errorf("command: %w", ErrEmptyName))
+		}
+
+		if cmd.Execute == nil {
+			problems = append(problems, fmt.Errorf("command %q: %w", cmd.Name, ErrMissingExecute))
+		}
+
+		if owner, ok := owners[cmd.Name]; ok {
+			problems = append(problems, fmt.Errorf("command %q: %w: name is also used by %q", cmd.Name, ErrDuplicateCommand, owner))
+		} else {
+			owners[cmd.Name] = cmd.Name
+		}
+
+		for _, aliases := range [][]string{cmd.Aliases, cmd.HiddenAliases} {
+			for _, alias := range aliases {
+				if owner, ok := owners[alias]; ok {
+					problems = append(problems, fmt.Errorf("command %q: %w: %q is also used by %q", cmd.Name, ErrDuplicateAlias, alias, owner))
+				} else {
+					owners[alias] = cmd.Name
+				}
+			}
+		}
+
+		if err := cmd.checkArgsBounds(); err != nil {
+			problems = append(problems, err)
+		}
+
+		expanded, err := c.expandFlagSets(cmd)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("command %q: %w", cmd.Name, err))
+		}
+
+		flags := make(map[string]bool, len(expanded.Flags))
+
+		for _, flag := range expanded.Flags {
+			if flag.Name == "" {
+				problems = append(problems, fmt.Errorf("command %q: flag: %w", cmd.Name, ErrEmptyName))
+			}
+
+			if flags[flag.Name] {
+				problems = append(problems, fmt.Errorf("command %q: %w: --%s", cmd.Name, ErrDuplicateFlag, flag.Name))
+			} else if flag.Name == "help" {
+				problems = append(problems, fmt.Errorf("command %q: %w: --help is reserved", cmd.Name, ErrDuplicateFlag))
+			}
+
+			flags[flag.Name] = true
+
+			if flag.Pattern != "" {
+				if _, err := compilePattern(flag.Pattern); err != nil {
+					problems = append(problems, fmt.Errorf("command %q: %w: flag --%s: %v", cmd.Name, ErrInvalidPattern, flag.Name, err))
+				}
 			}
 		}
 	}
+
+	for _, text := range []string{c.HelpTemplate, c.CommandHelpTemplate} {
+		if _, err := parseHelpTemplate(text); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	aliases := make([]string, 0, len(c.UserAliases))
+
+	for alias := range c.UserAliases {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		if _, err := c.expandUserAliases([]string{alias}); err != nil {
+			problems = append(problems, fmt.Errorf("user alias %q: %w", alias, err))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Problems: problems}
 }
 
 func (c *Config) Run() {
-	args := os.Args[1:]
+	if err := c.RunE(); err != nil && !errors.Is(err, ErrCommandNotFound) {
+		panic(err)
+	}
+}
 
-	c.commands = append(c.commands, Command{
-		Name:        "help",
-		Description: "Basic helper command where you can get information about commands.",
-		Execute: func(res *CmdResponse) {
-			args := res.Args["args"].([]string)
+// RunE is like Run but returns parse errors instead of panicking. An
+// unknown command prints the suggestions and the command list to
+// ErrorOutput and returns ErrCommandNotFound, which Run does not panic on.
+func (c *Config) RunE() error {
+	return c.RunContext(context.Background())
+}
 
-			if len(args) > 0 {
-				cname := args[0]
+// RunContext is like RunE but makes ctx available to Execute through
+// CmdResponse.Context. When CancelSignals is set, the context is also
+// cancelled as soon as one of those signals is received.
+func (c *Config) RunContext(ctx context.Context) error {
+	return c.run(ctx, c.args)
+}
+
+// run runs the app with args, or os.Args[1:] when args is nil.
+func (c *Config) run(ctx context.Context, args []string) error {
+	if len(c.CancelSignals) > 0 {
+		var stop context.CancelFunc
+
+		ctx, stop = signal.NotifyContext(ctx, c.CancelSignals...)
+		defer stop()
+	}
+
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	res, err := c.ParseE(args)
+	if err != nil {
+		return err
+	}
+
+	if res == nil {
+		if len(args) == 0 {
+			c.createCommandList()
+
+			return nil
+		}
+
+		c.printSuggestions(c.ErrorOutput(), args[0])
+		fmt.Fprint(c.ErrorOutput(), c.commandList())
+
+		return fmt.Errorf("%w: %s", ErrCommandNotFound, args[0])
+	}
+
+	res.ctx = ctx
+
+	return c.runHooked(res)
+}
+
+// Parse resolves the command named by args[0] and parses the remaining
+// arguments against it, exactly as Run does, without executing anything.
+// It returns nil when args is empty or names no known command.
+func (c *Config) Parse(args []string) *CmdResponse {
+	res, err := c.ParseE(args)
+	if err != nil {
+		panic(err)
+	}
+
+	return res
+}
+
+// ParseE is like Parse but returns parse errors instead of panicking.
+func (c *Config) ParseE(args []string) (*CmdResponse, error) {
+	raw := append([]string(nil), args...)
+
+	if c.ResponseFiles {
+		expanded, err := expandResponseFiles(args)
+		if err != nil {
+			return nil, err
+		}
+
+		args = expanded
+	}
+
+	args, err := c.expandUserAliases(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	if c.Version != "" && (args[0] == "--version" || args[0] == "-V") {
+		args = append([]string{"version"}, args[1:]...)
+	}
+
+	resolved, err := c.resolveCommand(args[0])
+	if err != nil || resolved == nil {
+		return nil, err
+	}
+
+	command, err := c.expandFlagSets(*resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &command
+
+	parsed, unknown, err := cmd.argParser(args[1:], c.StrictBoolFlags)
+	if err == errHelp {
+		return &CmdResponse{
+			Command:        c.commandHelpCommand(*cmd),
+			Args:           map[string]interface{}{"args": []string{cmd.Name}},
+			RawArgs:        raw,
+			RawCommandArgs: append([]string(nil), args[1:]...),
+		}, nil
+	}
+
+	if err != nil {
+		return nil, &commandError{command: resolved, err: err}
+	}
+
+	if err := cmd.validateArgs(parsed["args"].([]string)); err != nil {
+		return nil, &commandError{command: resolved, err: err}
+	}
+
+	return &CmdResponse{
+		Command:        *cmd,
+		Args:           parsed,
+		RawArgs:        raw,
+		RawCommandArgs: append([]string(nil), args[1:]...),
+		UnknownFlags:   unknown.values,
+		UnknownArgs:    unknown.args,
+	}, nil
+}
+
+// expandUserAliases replaces a leading user alias with its expansion until
+// the first argument names a real command or no alias. Real commands always
+// win over aliases of the same name.
+func (c *Config) expandUserAliases(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+
+	for len(args) > 0 {
+		if _, ok := c.findCommand(args[0]); ok {
+			break
+		}
+
+		expansion, ok := c.UserAliases[args[0]]
+		if !ok {
+			break
+		}
+
+		if seen[args[0]] {
+			return nil, fmt.Errorf("%w: %q", ErrRecursiveAlias, args[0])
+		}
+
+		seen[args[0]] = true
+		args = append(append([]string(nil), expansion...), args[1:]...)
+	}
+
+	return args, nil
+}
+
+// register appends cmd and indexes its name, aliases and flags.
+func (c *Config) register(cmd Command) {
+	if c.commandIndex == nil {
+		c.commandIndex = make(map[string]int)
+		c.nameIndex = make(map[string]int)
+	}
 
-				for i, cmd := range c.commands {
-					if cmd.Name == cname {
-						message := strings.Replace(CMD_HELP, "{CmdName}", cname, -1)
-						message = strings.Replace(message, "{CmdDescription}", cmd.Description, -1)
+	i := len(c.commands)
+	cmd.flagIndex = indexFlags(cmd.Flags)
+	c.commands = append(c.commands, cmd)
 
-						flags := []string{}
+	if _, ok := c.nameIndex[cmd.Name]; !ok {
+		c.nameIndex[cmd.Name] = i
+	}
+
+	if _, ok := c.commandIndex[cmd.Name]; !ok {
+		c.commandIndex[cmd.Name] = i
+	}
+
+	for _, aliases := range [][]string{cmd.Aliases, cmd.HiddenAliases} {
+		for _, alias := range aliases {
+			if _, ok := c.commandIndex[alias]; !ok {
+				c.commandIndex[alias] = i
+			}
+		}
+	}
+}
+
+// allCommands returns the registered commands followed by the built-ins.
+func (c *Config) allCommands() []Command {
+	return append(append([]Command(nil), c.commands...), c.builtinCommands()...)
+}
+
+// findBuiltin returns the enabled built-in command called name.
+func (c *Config) findBuiltin(name string) (*Command, bool) {
+	for _, cmd := range c.builtinCommands() {
+		if cmd.Name == name {
+			return &cmd, true
+		}
+	}
+
+	return nil, false
+}
+
+// findCommand returns the first command whose name or alias matches.
+func (c *Config) findCommand(name string) (*Command, bool) {
+	i, ok := c.commandIndex[name]
+	if !ok {
+		return c.findBuiltin(name)
+	}
 
-						for _, flag := range cmd.Flags {
-							flags = append(flags, fmt.Sprintf("--%s", flag.Name))
-						}
+	return &c.commands[i], true
+}
+
+// resolveCommand finds the command for name, falling back to a unique
+// name prefix when CommandAbbreviations is set. It returns nil without an
+// error when nothing matches.
+func (c *Config) resolveCommand(name string) (*Command, error) {
+	if cmd, ok := c.findCommand(name); ok {
+		return cmd, nil
+	}
+
+	if !c.CommandAbbreviations || name == "" {
+		return nil, nil
+	}
+
+	var candidates []Command
+
+	for _, cmd := range c.allCommands() {
+		if !cmd.Hidden && strings.HasPrefix(cmd.Name, name) {
+			candidates = append(candidates, cmd)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &candidates[0], nil
+	}
+
+	names := make([]string, len(candidates))
+
+	for i, candidate := range candidates {
+		names[i] = candidate.Name
+	}
+
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("%w: %q could be %s", ErrAmbiguousCommand, name, strings.Join(names, ", "))
+}
+
+// findCommandByName is like findCommand but ignores aliases.
+func (c *Config) findCommandByName(name string) (*Command, bool) {
+	i, ok := c.nameIndex[name]
+	if !ok {
+		return c.findBuiltin(name)
+	}
+
+	return &c.commands[i], true
+}
+
+// builtinCommands returns the built-in commands the current settings
+// enable, leaving out any whose name a registered command or alias
+// already uses. They are built on demand rather than registered, so
+// settings may change at any time and parsing never writes to the Config.
+func (c *Config) builtinCommands() []Command {
+	builtins := []Command{c.helpCommand()}
+
+	if c.CommandsCommand {
+		builtins = append(builtins, c.commandsCommand())
+	}
+
+	if c.Version != "" {
+		builtins = append(builtins, c.versionCommand())
+	}
 
-						message = strings.Replace(message, "{CmdFlags}", strings.Join(flags[:], ", "), -1)
-						message = strings.Replace(message, "{CmdAliases}", strings.Join(cmd.Aliases[:], ", "), -1)
+	enabled := builtins[:0]
 
-						fmt.Println(message)
-						break
-					} else if i == len(c.commands)-1 {
-						c.createCommandList()
-					}
+	for _, cmd := range builtins {
+		if _, taken := c.commandIndex[cmd.Name]; !taken {
+			enabled = append(enabled, cmd)
+		}
+	}
+
+	return enabled
+}
+
+func (c *Config) versionCommand() Command {
+	return Command{
+		Name:        "version",
+		Description: "Prints the version.",
+		builtin:     true,
+		Execute: func(res *CmdResponse) {
+			fmt.Fprintf(c.Output(), "%s version %s\n", c.AppName, c.Version)
+		},
+	}
+}
+
+func (c *Config) helpCommand() Command {
+	return Command{
+		Name:        "help",
+		Description: "Basic helper command where you can get information about commands.",
+		builtin:     true,
+		Execute: func(res *CmdResponse) {
+			args := res.Args["args"].([]string)
+
+			if len(args) > 0 {
+				if cmd, ok := c.findCommandByName(args[0]); ok {
+					c.PrintCommandHelp(cmd)
+				} else {
+					c.printSuggestions(c.Output(), args[0])
+					c.createCommandList()
 				}
 			} else {
 				c.createCommandList()
 			}
 		},
-	})
+	}
+}
 
-	if len(args) == 0 {
-		c.createCommandList()
+// commandHelpCommand returns the built-in command run in place of cmd when
+// it is given --help or -h. It prints cmd's help even when a registered
+// command replaces the built-in help command.
+func (c *Config) commandHelpCommand(cmd Command) Command {
+	help := c.helpCommand()
+	help.Execute = func(res *CmdResponse) {
+		c.PrintCommandHelp(&cmd)
+	}
 
-		return
+	return help
+}
+
+// PrintHelp prints the command list exactly as Run does when no command
+// is given.
+func (c *Config) PrintHelp() {
+	c.createCommandList()
+}
+
+// PrintCommandHelp prints the help for cmd exactly as 'help <command>' does.
+func (c *Config) PrintCommandHelp(cmd *Command) {
+	fmt.Fprint(c.Output(), c.HelpFor(cmd))
+}
+
+// HelpFor returns the help PrintCommandHelp prints for cmd.
+func (c *Config) HelpFor(cmd *Command) string {
+	if expanded, err := c.expandFlagSets(*cmd); err == nil {
+		cmd = &expanded
+	}
+
+	text := c.CommandHelpTemplate
+
+	if text == "" {
+		text = DefaultCommandHelpTemplate
+	}
+
+	return c.renderHelpTemplate(text, cmd)
+}
+
+// helpFlags returns the flags help lists for cmd.
+func (c *Config) helpFlags(cmd *Command) []string {
+	flags := []string{}
+
+	for _, flag := range cmd.Flags {
+		// --help is always listed last; a declared help flag is never set.
+		if flag.Hidden || flag.Name == "help" {
+			continue
+		}
+
+		if len(flag.Allowed) > 0 {
+			flags = append(flags, fmt.Sprintf("--%s <%s>", flag.Name, strings.Join(flag.Allowed, "|")))
+
+			continue
+		}
+
+		flags = append(flags, fmt.Sprintf("--%s", flag.Name))
+	}
+
+	if c.SortFlags {
+		sort.Strings(flags)
 	}
 
-	for i, cmd := range c.commands {
-		if cmd.Name == args[0] || *cmd.isValidAliase(args[0]) {
-			cmd.Execute(&CmdResponse{
-				Command: cmd,
-				Args:    cmd.argParser(args[1:]),
-			})
+	if !cmd.DisableFlagParsing && !cmd.builtin {
+		flags = append(flags, "--help")
+	}
+
+	return flags
+}
+
+// indentExample strips the indentation the lines of example share, e.g.
+// from a raw string literal, and indents each line by two spaces instead.
+func indentExample(example string) string {
+	lines := strings.Split(strings.Trim(example, "\n"), "\n")
+	common := -1
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if common == -1 || indent < common {
+			common = indent
+		}
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+
+			continue
+		}
+
+		lines[i] = "  " + strings.TrimRight(line[common:], " \t")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// commandUsage returns the app name followed by cmd.Usage, or by a usage
+// derived from the command's flags and ArgsMin/ArgsMax. Commands without
+// an upper bound or with an ArgsValidator take [args...].
+func (c *Config) commandUsage(cmd *Command) string {
+	parts := []string{c.AppName}
+
+	if cmd.Usage != "" {
+		return strings.Join(append(parts, cmd.Usage), " ")
+	}
+
+	parts = append(parts, cmd.Name)
+
+	for _, flag := range cmd.Flags {
+		if !flag.Hidden {
+			parts = append(parts, "[flags]")
+
 			break
-		} else if i == len(c.commands)-1 {
-			c.createCommandList()
 		}
 	}
+
+	if cmd.ArgsValidator != nil || cmd.ArgsMin == 0 && cmd.ArgsMax == 0 {
+		return strings.Join(append(parts, "[args...]"), " ")
+	}
+
+	for i := 0; i < cmd.ArgsMin; i++ {
+		parts = append(parts, "<arg>")
+	}
+
+	switch optional := cmd.ArgsMax - cmd.ArgsMin; {
+	case cmd.ArgsMax == 0, optional > 1:
+		parts = append(parts, "[arg...]")
+	case optional == 1:
+		parts = append(parts, "[arg]")
+	}
+
+	return strings.Join(parts, " ")
 }
 
-func (c *Config) createCommandList() {
-	var cmds []string
+// suggestionDistance is the largest edit distance at which a command name
+// or alias is still suggested for an unknown name.
+const suggestionDistance = 2
 
-	for _, cmd := range c.commands {
-		var command string = strings.Replace(CMD_LIST, "{CmdName}", cmd.Name, -1)
-		command = strings.Replace(command, "{CmdDescription}", cmd.Description, -1)
+// suggestions returns the names of commands that list name in SuggestFor,
+// followed, unless DisableSuggestions is set, by commands whose name or
+// alias is within suggestionDistance edits of name.
+func (c *Config) suggestions(name string) []string {
+	var names []string
 
-		cmds = append(cmds, command)
+	seen := make(map[string]bool)
+	commands := c.allCommands()
+
+	for _, cmd := range commands {
+		if cmd.Hidden {
+			continue
+		}
+
+		for _, suggestFor := range cmd.SuggestFor {
+			if suggestFor == name {
+				names = append(names, cmd.Name)
+				seen[cmd.Name] = true
+
+				break
+			}
+		}
 	}
 
-	var logmsg string = strings.Replace(MAIN_TEMPLATE, "{AppName}", c.AppName, -1)
-	logmsg = strings.Replace(logmsg, "{CmdList}", strings.Join(cmds, "\n"), -1)
+	if c.DisableSuggestions {
+		return names
+	}
+
+	for _, cmd := range commands {
+		if cmd.Hidden || seen[cmd.Name] {
+			continue
+		}
+
+		for _, candidate := range append([]string{cmd.Name}, cmd.Aliases...) {
+			if levenshtein(name, candidate) <= suggestionDistance {
+				names = append(names, cmd.Name)
+				seen[cmd.Name] = true
+
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// levenshtein returns the number of single rune edits needed to turn a
+// into b, ignoring case.
+func levenshtein(a, b string) int {
+	s, t := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
+
+func (c *Config) printSuggestions(w io.Writer, name string) {
+	names := c.suggestions(name)
+	if len(names) == 0 {
+		return
+	}
+
+	quoted := make([]string, len(names))
+
+	for i, suggestion := range names {
+		quoted[i] = fmt.Sprintf("'%s'", suggestion)
+	}
+
+	message := strings.Replace(SUGGESTION, "{CmdName}", name, -1)
+	message = strings.Replace(message, "{Suggestions}", strings.Join(quoted, " or "), -1)
+
+	fmt.Fprintln(w, message)
+}
+
+func (c *Config) createCommandList() {
+	fmt.Fprint(c.Output(), c.commandList())
+}
+
+func (c *Config) commandList() string {
+	text := c.HelpTemplate
+
+	if text == "" {
+		text = DefaultHelpTemplate
+	}
 
-	fmt.Println(logmsg)
+	return c.renderHelpTemplate(text, nil)
 }
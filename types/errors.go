@@ -0,0 +1,96 @@
+package types
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrDuplicateCommand = errors.New("there is a command with the name you are trying to add")
+	ErrMissingExecute   = errors.New("command has no Execute function")
+	ErrUnknownFlagSet   = errors.New("unknown flag set")
+	ErrDuplicateFlag    = errors.New("flag is already defined on the command")
+	ErrInvalidPattern   = errors.New("invalid flag pattern")
+	ErrRequiredFlag     = errors.New("required flag not specified")
+	ErrInvalidFlagValue = errors.New("invalid flag value")
+	ErrMissingFlagValue = errors.New("flag needs a value")
+	ErrRecursiveAlias   = errors.New("user alias expands to itself")
+	ErrEmptyName        = errors.New("name is empty")
+	ErrDuplicateAlias   = errors.New("alias is already in use")
+	ErrAmbiguousCommand = errors.New("ambiguous command abbreviation")
+	ErrResponseFile     = errors.New("cannot read response file")
+	ErrFlagTypeExists   = errors.New("flag type is already registered")
+	ErrInvalidArgs      = errors.New("invalid arguments")
+	ErrInvalidBindDest  = errors.New("bind target must be a non-nil pointer to a struct")
+	ErrInvalidBindTag   = errors.New("invalid kommando struct tag")
+	ErrUnsupportedField = errors.New("unsupported field type")
+	ErrUnknownFlag      = errors.New("unknown flag")
+	ErrInvalidTemplate  = errors.New("invalid help template")
+	ErrCommandNotFound  = errors.New("unknown command")
+	ErrInvalidFlagType  = errors.New("invalid flag type")
+)
+
+// ValidationError lists every problem Config.Validate found, one per line.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+
+	for i, problem := range e.Problems {
+		lines[i] = problem.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Is reports whether any of the problems matches target.
+func (e *ValidationError) Is(target error) bool {
+	for _, problem := range e.Problems {
+		if errors.Is(problem, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InvalidArgsError is returned for positional arguments a command does
+// not accept, with the number of arguments it got and its ArgsMin and
+// ArgsMax. It matches ErrInvalidArgs and unwraps to the ArgsValidator's
+// error, or to one describing the expected count.
+type InvalidArgsError struct {
+	Command  string
+	Got      int
+	Min, Max int
+	Err      error
+}
+
+func (e *InvalidArgsError) Error() string {
+	return ErrInvalidArgs.Error() + ": " + e.Command + ": " + e.Err.Error()
+}
+
+func (e *InvalidArgsError) Is(target error) bool {
+	return target == ErrInvalidArgs
+}
+
+func (e *InvalidArgsError) Unwrap() error {
+	return e.Err
+}
+
+// commandError ties a parse error to the command it was parsing, so the
+// usage line printed with it names that command even when it was reached
+// through an alias or a response file.
+type commandError struct {
+	command *Command
+	err     error
+}
+
+func (e *commandError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
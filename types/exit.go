@@ -0,0 +1,107 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExitError lets a Before or After hook choose the exit code RunAndExit
+// uses for the error it returns.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// usageErrors are the errors ExitCode reports as command line mistakes.
+var usageErrors = []error{
+	ErrRequiredFlag,
+	ErrInvalidFlagValue,
+	ErrMissingFlagValue,
+	ErrInvalidArgs,
+	ErrAmbiguousCommand,
+	ErrRecursiveAlias,
+	ErrResponseFile,
+	ErrCommandNotFound,
+}
+
+// ExitCode returns the process exit code for an error returned by RunE:
+// 0 for nil, the code of an ExitError, 2 for command line mistakes such as
+// a missing required flag, and 1 for anything else.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	if isUsageError(err) {
+		return 2
+	}
+
+	return 1
+}
+
+func isUsageError(err error) bool {
+	for _, target := range usageErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunAndExit runs the app with args, or with the same arguments as RunE
+// when args is nil, and exits the process with ExitCode. It never changes
+// the arguments set with SetArgs. Errors are printed to ErrorOutput,
+// prefixed with the app name, followed by the usage line of the command
+// for command line mistakes.
+func (c *Config) RunAndExit(args []string) {
+	if args == nil {
+		args = c.args
+	}
+
+	err := c.run(context.Background(), args)
+
+	if err != nil {
+		c.printError(err)
+	}
+
+	os.Exit(ExitCode(err))
+}
+
+func (c *Config) printError(err error) {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && exitErr.Err == nil {
+		return
+	}
+
+	fmt.Fprintf(c.ErrorOutput(), "%s: %v\n", c.AppName, err)
+
+	if !isUsageError(err) {
+		return
+	}
+
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		fmt.Fprintln(c.ErrorOutput(), strings.Replace(USAGE_LINE, "{Usage}", c.commandUsage(cmdErr.command), -1))
+	}
+}
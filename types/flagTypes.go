@@ -0,0 +1,57 @@
+package types
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FlagTypeParser converts a raw flag value into the value stored in
+// CmdResponse.Args, or returns an error when the value is invalid.
+type FlagTypeParser func(value string) (interface{}, error)
+
+var (
+	flagTypesMu sync.RWMutex
+	flagTypes   = make(map[string]FlagTypeParser)
+)
+
+var builtinFlagTypes = map[string]bool{
+	"":       true,
+	"string": true,
+	"bool":   true,
+	"int":    true,
+	"float":  true,
+}
+
+// RegisterFlagType makes name usable as a Flag.ValueType. Values of such
+// flags are validated with parse, and its result is what Execute finds
+// in CmdResponse.Args. Built-in type names cannot be registered, and
+// neither can a name that is already registered or a nil parse.
+func RegisterFlagType(name string, parse FlagTypeParser) error {
+	if builtinFlagTypes[name] {
+		return fmt.Errorf("%w: %q is a built-in type", ErrFlagTypeExists, name)
+	}
+
+	flagTypesMu.Lock()
+	defer flagTypesMu.Unlock()
+
+	if _, ok := flagTypes[name]; ok {
+		return fmt.Errorf("%w: %q", ErrFlagTypeExists, name)
+	}
+
+	if parse == nil {
+		return fmt.Errorf("%w: %q has a nil parser", ErrInvalidFlagType, name)
+	}
+
+	flagTypes[name] = parse
+
+	return nil
+}
+
+func lookupFlagType(name string) (FlagTypeParser, bool) {
+	flagTypesMu.RLock()
+	defer flagTypesMu.RUnlock()
+
+	parse, ok := flagTypes[name]
+
+	return parse, ok
+}
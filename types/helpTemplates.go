@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultHelpTemplate and DefaultCommandHelpTemplate produce the command
+// list and the command help when HelpTemplate and CommandHelpTemplate are
+// empty. Copy one to change part of the layout.
+const (
+	DefaultHelpTemplate = "Welcome to {{.AppName}}! That's a command list. Type 'help <command name>' to get help with any command.\n" +
+		"{{if .Usage}}Usage: {{.Usage}}\n{{end}}" +
+		"{{range .Commands}}{{if not .Hidden}}{{.Name}} |> {{.Description}}\n{{end}}{{end}}"
+	DefaultCommandHelpTemplate = "{{.Command.Name}} | Info\n" +
+		"Usage: {{.CommandUsage}}\n" +
+		"Description |> {{.Command.Description}}\n" +
+		"Flags |> {{join .Flags \", \"}}\n" +
+		"Aliases |> {{join .Command.Aliases \", \"}}\n" +
+		"{{if .Command.Example}}Examples:\n{{.Examples}}\n{{end}}"
+)
+
+// HelpData is what HelpTemplate and CommandHelpTemplate are executed with.
+type HelpData struct {
+	AppName string
+	// Usage is Config.Usage and Version is Config.Version.
+	Usage   string
+	Version string
+	// Commands holds every registered command, built-ins and hidden ones
+	// included, in registration order.
+	Commands []Command
+	// Command is the command help is shown for, nil in the command list.
+	// CommandUsage is its usage line without the "Usage: " prefix.
+	Command      *Command
+	CommandUsage string
+	// Flags lists the command's visible flags as the default help shows
+	// them, e.g. "--format <json|yaml>", sorted with SortFlags and with
+	// --help last. Examples is Command.Example with its lines re-indented.
+	Flags    []string
+	Examples string
+}
+
+// helpFuncs are available to help templates in addition to the built-in
+// text/template functions.
+var helpFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+func parseHelpTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("help").Funcs(helpFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	return tmpl, nil
+}
+
+// renderHelpTemplate executes text for cmd, or for the command list when cmd
+// is nil. Template errors are rendered in place of the help, since help has
+// no error to return; Validate reports templates that do not parse.
+func (c *Config) renderHelpTemplate(text string, cmd *Command) string {
+	data := HelpData{
+		AppName:  c.AppName,
+		Usage:    c.Usage,
+		Version:  c.Version,
+		Commands: c.allCommands(),
+		Command:  cmd,
+	}
+
+	if cmd != nil {
+		data.CommandUsage = c.commandUsage(cmd)
+		data.Flags = c.helpFlags(cmd)
+
+		if cmd.Example != "" {
+			data.Examples = indentExample(cmd.Example)
+		}
+	}
+
+	tmpl, err := parseHelpTemplate(text)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+
+	var out strings.Builder
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return fmt.Sprintf("%v: %v\n", ErrInvalidTemplate, err)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,56 @@
+package types
+
+// runHooked executes res.Command between the app's and the command's
+// Before and After hooks, reporting the whole run to Telemetry. Built-in
+// commands run without hooks or telemetry.
+func (c *Config) runHooked(res *CmdResponse) error {
+	if res.Command.builtin {
+		res.Command.Execute(res)
+
+		return nil
+	}
+
+	if c.Telemetry == nil {
+		return c.runHooks(res)
+	}
+
+	return c.withTelemetry(res, func() error {
+		return c.runHooks(res)
+	})
+}
+
+// runHooks returns the first Before error, or else the first After error.
+// After hooks run in reverse order, and they also run while a panic from
+// Execute unwinds.
+func (c *Config) runHooks(res *CmdResponse) (err error) {
+	var afters []func(res *CmdResponse) error
+
+	defer func() {
+		for i := len(afters) - 1; i >= 0; i-- {
+			if afterErr := afters[i](res); afterErr != nil && err == nil {
+				err = afterErr
+			}
+		}
+	}()
+
+	hooks := [][2]func(res *CmdResponse) error{
+		{c.Before, c.After},
+		{res.Command.Before, res.Command.After},
+	}
+
+	for _, hook := range hooks {
+		if hook[0] != nil {
+			if err := hook[0](res); err != nil {
+				return err
+			}
+		}
+
+		if hook[1] != nil {
+			afters = append(afters, hook[1])
+		}
+	}
+
+	res.Command.Execute(res)
+
+	return nil
+}
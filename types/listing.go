@@ -0,0 +1,129 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type commandInfo struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Aliases     []string   `json:"aliases"`
+	Flags       []flagInfo `json:"flags"`
+	Runnable    bool       `json:"runnable"`
+}
+
+type flagInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Allowed     []string `json:"allowed,omitempty"`
+}
+
+func (c *Config) commandsCommand() Command {
+	return Command{
+		Name:        "commands",
+		Description: "Lists every command with its aliases and flags.",
+		Flags: []Flag{
+			{
+				Name:               "format",
+				Description:        "Output format, text or json.",
+				ValueType:          "string",
+				Pattern:            "^(text|json)$",
+				PatternDescription: "expected text or json",
+			},
+			{
+				Name:        "all",
+				Description: "Include hidden commands and flags.",
+				ValueType:   "bool",
+			},
+		},
+		Execute: func(res *CmdResponse) {
+			value, _ := res.Args["all"].(string)
+			all, _ := strconv.ParseBool(value)
+			infos := c.commandInfos(all)
+
+			if res.Args["format"] == "json" {
+				data, _ := json.MarshalIndent(infos, "", "  ")
+
+				fmt.Fprintln(c.Output(), string(data))
+
+				return
+			}
+
+			for _, info := range infos {
+				name := info.Name
+
+				if len(info.Aliases) > 0 {
+					name = fmt.Sprintf("%s (%s)", name, strings.Join(info.Aliases, ", "))
+				}
+
+				fmt.Fprintf(c.Output(), "%s |> %s\n", name, info.Description)
+
+				for _, flag := range info.Flags {
+					var required string
+
+					if flag.Required {
+						required = " (required)"
+					}
+
+					fmt.Fprintf(c.Output(), "  --%s <%s>%s |> %s\n", flag.Name, flag.Type, required, flag.Description)
+				}
+			}
+		},
+		builtin: true,
+	}
+}
+
+// commandInfos describes the registered commands in registration order,
+// leaving hidden commands and flags out unless all is set. Every command
+// has an Execute, so all of them are runnable.
+func (c *Config) commandInfos(all bool) []commandInfo {
+	commands := c.allCommands()
+	infos := make([]commandInfo, 0, len(commands))
+
+	for _, cmd := range commands {
+		if cmd.Hidden && !all {
+			continue
+		}
+
+		if expanded, err := c.expandFlagSets(cmd); err == nil {
+			cmd = expanded
+		}
+
+		info := commandInfo{
+			Name:        cmd.Name,
+			Description: cmd.Description,
+			Aliases:     append([]string{}, cmd.Aliases...),
+			Flags:       make([]flagInfo, 0, len(cmd.Flags)),
+			Runnable:    cmd.Execute != nil,
+		}
+
+		for _, flag := range cmd.Flags {
+			if flag.Hidden && !all {
+				continue
+			}
+
+			valueType := flag.ValueType
+
+			if valueType == "" {
+				valueType = "string"
+			}
+
+			info.Flags = append(info.Flags, flagInfo{
+				Name:        flag.Name,
+				Description: flag.Description,
+				Type:        valueType,
+				Required:    flag.Required != nil && *flag.Required,
+				Allowed:     flag.Allowed,
+			})
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandResponseFiles replaces every "@path" argument before a "--" with
+// the tokens read from that file. Response files cannot reference other
+// response files.
+func expandResponseFiles(args []string) ([]string, error) {
+	output := make([]string, 0, len(args))
+
+	for ind, arg := range args {
+		if arg == "--" {
+			output = append(output, args[ind:]...)
+
+			break
+		}
+
+		if !strings.HasPrefix(arg, "@") || arg == "@" {
+			output = append(output, arg)
+
+			continue
+		}
+
+		data, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrResponseFile, err)
+		}
+
+		tokens, err := splitResponseFile(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrResponseFile, arg[1:], err)
+		}
+
+		for _, token := range tokens {
+			if strings.HasPrefix(token, "@") && token != "@" {
+				return nil, fmt.Errorf("%w: %s: nested response file %q is not supported", ErrResponseFile, arg[1:], token)
+			}
+		}
+
+		output = append(output, tokens...)
+	}
+
+	return output, nil
+}
+
+// splitResponseFile splits the contents of a response file into tokens
+// separated by whitespace. Single or double quotes group characters,
+// including spaces, into one token, and lines starting with '#' are
+// comments.
+func splitResponseFile(data string) ([]string, error) {
+	var tokens []string
+
+	for _, line := range strings.Split(data, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		var (
+			token   strings.Builder
+			quote   rune
+			inToken bool
+		)
+
+		for _, char := range line {
+			switch {
+			case quote != 0 && char == quote:
+				quote = 0
+			case quote != 0:
+				token.WriteRune(char)
+			case char == '"' || char == '\'':
+				quote, inToken = char, true
+			case char == ' ' || char == '\t' || char == '\r':
+				if inToken {
+					tokens = append(tokens, token.String())
+					token.Reset()
+					inToken = false
+				}
+			default:
+				token.WriteRune(char)
+				inToken = true
+			}
+		}
+
+		if quote != 0 {
+			return nil, fmt.Errorf("unterminated %c quote", quote)
+		}
+
+		if inToken {
+			tokens = append(tokens, token.String())
+		}
+	}
+
+	return tokens, nil
+}
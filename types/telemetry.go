@@ -0,0 +1,54 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// Telemetry receives a notification around every command run, including
+// its Before and After hooks. It is not called for the built-in help
+// command or when the command list is printed, and it cannot change the
+// outcome of a run: panics inside the handler are recovered and discarded.
+type Telemetry interface {
+	OnCommandStart(path []string, res *CmdResponse)
+	// OnCommandEnd receives the error the run ended with: the error
+	// returned by a Before or After hook, or one describing a panic.
+	OnCommandEnd(path []string, err error, duration time.Duration)
+}
+
+// withTelemetry calls run between OnCommandStart and OnCommandEnd.
+func (c *Config) withTelemetry(res *CmdResponse, run func() error) (err error) {
+	path := []string{res.Command.Name}
+	start := time.Now()
+
+	safeTelemetry(func() {
+		c.Telemetry.OnCommandStart(path, res)
+	})
+
+	defer func() {
+		endErr := err
+
+		r := recover()
+		if r != nil {
+			endErr = fmt.Errorf("command panicked: %v", r)
+		}
+
+		safeTelemetry(func() {
+			c.Telemetry.OnCommandEnd(path, endErr, time.Since(start))
+		})
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	return run()
+}
+
+func safeTelemetry(fn func()) {
+	defer func() {
+		_ = recover()
+	}()
+
+	fn()
+}